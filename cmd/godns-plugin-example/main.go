@@ -0,0 +1,161 @@
+// Command godns-plugin-example is the reference GoDNS provider plugin. It
+// keeps the records in a JSON file, or in memory when no path is configured:
+//
+//	"provider": "Plugin",
+//	"plugin": {
+//	  "command": "godns-plugin-example",
+//	  "config": {"path": "/var/lib/godns/records.json"}
+//	}
+//
+// Plugins read one JSON-RPC 2.0 request per line on stdin, and write one
+// response per line on stdout.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jmbayu/godns/handler/plugin"
+)
+
+type config struct {
+	Path string `json:"path"`
+}
+
+type store struct {
+	path    string
+	records []plugin.Record
+}
+
+func main() {
+	log.SetFlags(0)
+
+	s := &store{}
+	out := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req plugin.Request
+		resp := plugin.Response{JSONRPC: "2.0"}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = &plugin.Error{Code: plugin.CodeParseError, Message: err.Error()}
+		} else {
+			resp.ID = req.ID
+			result, err := s.handle(req)
+			if err != nil {
+				resp.Error = err
+			} else {
+				resp.Result, _ = json.Marshal(result)
+			}
+		}
+
+		if err := out.Encode(resp); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func (s *store) handle(req plugin.Request) (interface{}, *plugin.Error) {
+	switch req.Method {
+	case plugin.MethodCapabilities:
+		var params plugin.CapabilitiesParams
+		var conf config
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if len(params.Config) > 0 {
+			if err := json.Unmarshal(params.Config, &conf); err != nil {
+				return nil, invalidParams(err)
+			}
+		}
+		if err := s.load(conf.Path); err != nil {
+			return nil, &plugin.Error{Code: plugin.CodeInternalError, Message: err.Error()}
+		}
+		return plugin.Capabilities{
+			Name:    "example",
+			Methods: []string{plugin.MethodCapabilities, plugin.MethodGetRecords, plugin.MethodSetRecord},
+		}, nil
+
+	case plugin.MethodGetRecords:
+		var params plugin.GetRecordsParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		result := plugin.GetRecordsResult{Records: []plugin.Record{}}
+		for _, rec := range s.records {
+			if s.matches(rec, params.Domain, params.SubDomain, params.Type) {
+				result.Records = append(result.Records, rec)
+			}
+		}
+		return result, nil
+
+	case plugin.MethodSetRecord:
+		var params plugin.SetRecordParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if params.Domain == "" || params.Type == "" || params.Value == "" {
+			return nil, invalidParams(fmt.Errorf("domain, type and value are required"))
+		}
+		s.set(plugin.Record(params))
+		if err := s.save(); err != nil {
+			return nil, &plugin.Error{Code: plugin.CodeInternalError, Message: err.Error()}
+		}
+		log.Printf("%s.%s %s set to %s", params.SubDomain, params.Domain, params.Type, params.Value)
+		return struct{}{}, nil
+	}
+
+	return nil, &plugin.Error{Code: plugin.CodeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func (s *store) matches(rec plugin.Record, domain, subDomain, recordType string) bool {
+	return strings.EqualFold(rec.Domain, domain) &&
+		strings.EqualFold(rec.SubDomain, subDomain) &&
+		(recordType == "" || strings.EqualFold(rec.Type, recordType))
+}
+
+func (s *store) set(record plugin.Record) {
+	for i, rec := range s.records {
+		if s.matches(rec, record.Domain, record.SubDomain, record.Type) {
+			s.records[i] = record
+			return
+		}
+	}
+	s.records = append(s.records, record)
+}
+
+func (s *store) load(path string) error {
+	s.path = path
+	if path == "" {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, &s.records)
+}
+
+func (s *store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, content, 0600)
+}
+
+func invalidParams(err error) *plugin.Error {
+	return &plugin.Error{Code: plugin.CodeInvalidParams, Message: err.Error()}
+}
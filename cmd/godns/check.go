@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/jmbayu/godns"
+	"github.com/jmbayu/godns/handler"
+)
+
+// checkTable prints the outcome of the checks once they are done
+type checkTable struct {
+	w      *tabwriter.Writer
+	failed bool
+}
+
+func (t *checkTable) row(name string, err error, passed string) {
+	err = godns.RedactError(err)
+	switch {
+	case err == godns.ErrNotSupported:
+		fmt.Fprintf(t.w, "%s\t%s\t%s\n", name, color.YellowString("SKIP"), err)
+	case err != nil:
+		t.failed = true
+		fmt.Fprintf(t.w, "%s\t%s\t%s\n", name, color.RedString("FAIL"), err)
+	default:
+		fmt.Fprintf(t.w, "%s\t%s\t%s\n", name, color.GreenString("PASS"), passed)
+	}
+}
+
+// done prints the table and exits with 1 when any check failed
+func (t *checkTable) done() {
+	t.w.Flush()
+	if t.failed {
+		os.Exit(1)
+	}
+}
+
+// check validates the settings, then checks them against the provider and
+// the notifiers, it exits with 1 when any check fails
+func check() {
+	t := &checkTable{w: tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)}
+	fmt.Fprintln(t.w, "CHECK\tRESULT\tDETAILS")
+
+	if err := godns.CheckSettings(&configuration); err != nil {
+		if errs, ok := err.(godns.ConfigErrors); ok {
+			for _, e := range errs {
+				t.row("config "+e.Path, fmt.Errorf("%s", e.Message), "")
+			}
+		} else {
+			t.row("config", err, "")
+		}
+		t.done()
+	}
+	t.row("config", nil, "valid")
+
+	// the IP sources used by the domains and their failovers, the top
+	// level one when none is
+	sources := []string{""}
+	if len(configuration.IPSources) > 0 {
+		sources = nil
+		seen := map[string]bool{}
+		for _, domain := range godns.SplitByIPSource(configuration.Domains) {
+			used := []string{domain.IPSource}
+			if len(domain.Failover.IPSources) > 0 {
+				used = domain.Failover.IPSources
+			}
+			for _, source := range used {
+				if !seen[source] {
+					seen[source] = true
+					sources = append(sources, source)
+				}
+			}
+		}
+	}
+	for _, source := range sources {
+		if source != "" {
+			// with its health check, if any
+			ip, err := godns.CheckIPSource(&configuration, source)
+			t.row("current IP "+source, err, ip)
+			continue
+		}
+		ip, err := godns.GetCurrentIP(&configuration)
+		if err == nil && ip == "" {
+			err = fmt.Errorf("no IP found, check ip_url, ipv6_url or ip_interface")
+		}
+		t.row("current IP", err, ip)
+	}
+
+	h := handler.CreateHandler(configuration.Provider)
+	h.SetConfiguration(&configuration)
+	checker, ok := h.(handler.IChecker)
+	if !ok {
+		t.row("provider "+configuration.Provider, godns.ErrNotSupported, "")
+	} else if err := checker.CheckAuth(); err != nil {
+		t.row("provider "+configuration.Provider, err, "")
+	} else {
+		t.row("provider "+configuration.Provider, nil, "authenticated")
+
+		recordType := "A"
+		if strings.ToUpper(configuration.IPType) == godns.IPV6 {
+			recordType = "AAAA"
+		}
+		for _, domain := range configuration.Domains {
+			for _, subDomain := range domain.SubDomains {
+				name := fmt.Sprintf("record %s.%s (%s)", subDomain, domain.DomainName, recordType)
+				t.row(name, checker.CheckRecord(domain.DomainName, subDomain), "exists")
+			}
+		}
+	}
+
+	for _, notify := range godns.SendTestNotify(&configuration) {
+		t.row("notify "+notify.Notifier, notify.Err, "test message sent")
+	}
+
+	t.done()
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/jmbayu/godns"
+	"github.com/jmbayu/godns/handler"
+)
+
+// drift is the value of a hostname at each place it can be read from
+type drift struct {
+	Hostname      string `json:"hostname"`
+	Type          string `json:"type"`
+	Current       string `json:"current"`
+	Provider      string `json:"provider"`
+	Authoritative string `json:"authoritative"`
+	Resolver      string `json:"resolver"`
+	// Member is set for the round-robin records, whose values are in sync
+	// when they contain the current IP
+	Member bool `json:"member,omitempty"`
+	Drift  bool `json:"drift"`
+}
+
+// diff compares, for every configured hostname, the current IP with the
+// value at the provider, on the authoritative name servers and on the
+// resolver, it exits with 1 when any of them disagrees
+func diff() {
+	if err := godns.CheckSettings(&configuration); err != nil {
+		fmt.Println("Settings is invalid! ", err.Error())
+		os.Exit(1)
+	}
+
+	h := handler.CreateHandler(configuration.Provider)
+	h.SetConfiguration(&configuration)
+
+	recordType := "A"
+	if strings.ToUpper(configuration.IPType) == godns.IPV6 {
+		recordType = "AAAA"
+	}
+
+	// the current IP of each IP source, looked up once
+	currents := map[string]string{}
+	currentIP := func(source string) string {
+		if current, ok := currents[source]; ok {
+			return current
+		}
+		current, err := godns.GetCurrentIP(godns.IPSourceSettings(&configuration, source))
+		if err != nil {
+			current = "error: " + godns.Redact(err.Error())
+		}
+		currents[source] = current
+		return current
+	}
+
+	var rows []drift
+	drifted := false
+	for _, domain := range configuration.Domains {
+		failoverIP := ""
+		if len(domain.Failover.IPSources) > 0 {
+			ip, err := godns.GetDomainIP(&configuration, &domain)
+			if err != nil {
+				ip = "error: " + godns.Redact(err.Error())
+			}
+			failoverIP = ip
+		}
+
+		for _, subDomain := range domain.SubDomains {
+			hostname := domain.DomainName
+			if subDomain != "@" {
+				hostname = subDomain + "." + domain.DomainName
+			}
+
+			current := failoverIP
+			if current == "" {
+				current = currentIP(domain.IPSourceOf(subDomain))
+			}
+
+			member := domain.IsMember(subDomain)
+			row := drift{
+				Hostname:      hostname,
+				Type:          recordType,
+				Current:       current,
+				Provider:      providerValue(h, domain.DomainName, subDomain, hostname, recordType),
+				Authoritative: authoritativeValue(hostname, member),
+				Resolver:      resolve(hostname, configuration.Resolver, member),
+				Member:        member,
+			}
+			row.Drift = hasDrift(row)
+			drifted = drifted || row.Drift
+			rows = append(rows, row)
+		}
+	}
+
+	printDiff(os.Stdout, rows)
+	if drifted {
+		os.Exit(1)
+	}
+}
+
+// hasDrift reports whether a value of row disagrees with its current IP,
+// or does not contain it for a round-robin record. The values which could
+// not be read, n/a or errors, are left out, they are not known to
+// disagree.
+func hasDrift(row drift) bool {
+	if !known(row.Current) {
+		return false
+	}
+	for _, value := range []string{row.Provider, row.Authoritative, row.Resolver} {
+		if !known(value) {
+			continue
+		}
+		if row.Member && !contains(strings.Split(value, ","), row.Current) {
+			return true
+		}
+		if !row.Member && value != row.Current {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func known(value string) bool {
+	return value != "n/a" && !strings.HasPrefix(value, "error: ")
+}
+
+// providerValue reads the record of hostname through the provider API
+func providerValue(h handler.IHandler, domain, subDomain, hostname, recordType string) string {
+	var list []godns.Record
+	var err error
+	if getter, ok := h.(handler.IRecordGetter); ok {
+		list, err = getter.GetRecords(domain, subDomain)
+	} else if lister, ok := h.(handler.IRecordLister); ok {
+		list, err = lister.ListRecords(domain)
+	} else {
+		return "n/a"
+	}
+	if err != nil {
+		return "error: " + godns.Redact(err.Error())
+	}
+
+	var values []string
+	for _, rec := range list {
+		if strings.EqualFold(strings.TrimSuffix(rec.Name, "."), hostname) && strings.EqualFold(rec.Type, recordType) {
+			values = append(values, rec.Value)
+		}
+	}
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ",")
+}
+
+// authoritativeValue asks the first name server of the zone which answers,
+// for every address of the round-robin records
+func authoritativeValue(hostname string, member bool) string {
+	servers, err := godns.AuthoritativeServers(hostname, configuration.Resolver)
+	if err != nil {
+		return "error: " + godns.Redact(err.Error())
+	}
+
+	var value string
+	for _, server := range servers {
+		if value = resolve(hostname, server, member); !strings.HasPrefix(value, "error: ") {
+			break
+		}
+	}
+	return value
+}
+
+// resolve returns the address of hostname, or every address joined with
+// commas for the round-robin records
+func resolve(hostname, server string, member bool) string {
+	if member {
+		ips, err := godns.ResolveDNSAll(hostname, server, configuration.IPType)
+		if err != nil {
+			return "error: " + godns.Redact(err.Error())
+		}
+		return strings.Join(ips, ",")
+	}
+
+	ip, err := godns.ResolveDNS(hostname, server, configuration.IPType)
+	if err != nil {
+		return "error: " + godns.Redact(err.Error())
+	}
+	return ip
+}
+
+// printDiff prints the rows to out as a table, the drifting ones in red,
+// or in JSON with -o json
+func printDiff(out io.Writer, rows []drift) {
+	if *optOutput == "json" {
+		if rows == nil {
+			rows = []drift{}
+		}
+		content, _ := json.MarshalIndent(rows, "", "  ")
+		fmt.Fprintln(out, string(content))
+		return
+	}
+
+	// align the columns first, escape codes would count in their widths
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOSTNAME\tTYPE\tCURRENT\tPROVIDER\tAUTHORITATIVE\tRESOLVER")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", row.Hostname, row.Type, row.Current, row.Provider, row.Authoritative, row.Resolver)
+	}
+	w.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	fmt.Fprintln(out, lines[0])
+	for i, row := range rows {
+		if row.Drift {
+			fmt.Fprintln(out, color.RedString(lines[i+1]))
+		} else {
+			fmt.Fprintln(out, lines[i+1])
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/jmbayu/godns"
+)
+
+// recordsHandler reads the records of a subdomain, or fails with err
+type recordsHandler struct {
+	records []godns.Record
+	err     error
+}
+
+func (h *recordsHandler) SetConfiguration(*godns.Settings)              {}
+func (h *recordsHandler) DomainLoop(*godns.Domain, chan<- godns.Domain) {}
+
+func (h *recordsHandler) GetRecords(domain, subDomain string) ([]godns.Record, error) {
+	return h.records, h.err
+}
+
+// updateOnlyHandler cannot read records
+type updateOnlyHandler struct{}
+
+func (h updateOnlyHandler) SetConfiguration(*godns.Settings)              {}
+func (h updateOnlyHandler) DomainLoop(*godns.Domain, chan<- godns.Domain) {}
+
+func TestProviderValue(t *testing.T) {
+	h := &recordsHandler{records: []godns.Record{
+		{Name: "www.example.com.", Type: "A", Value: "203.0.113.20"},
+		{Name: "www.example.com", Type: "A", Value: "203.0.113.21"},
+		{Name: "www.example.com", Type: "AAAA", Value: "2001:db8::1"},
+		{Name: "home.example.com", Type: "A", Value: "198.51.100.7"},
+	}}
+
+	if value := providerValue(h, "example.com", "www", "www.example.com", "A"); value != "203.0.113.20,203.0.113.21" {
+		t.Errorf("the A records of www should be read, got %s", value)
+	}
+	if value := providerValue(h, "example.com", "mail", "mail.example.com", "A"); value != "none" {
+		t.Errorf("a missing record should be none, got %s", value)
+	}
+	if value := providerValue(updateOnlyHandler{}, "example.com", "www", "www.example.com", "A"); value != "n/a" {
+		t.Errorf("a provider which cannot read records should be n/a, got %s", value)
+	}
+
+	h = &recordsHandler{err: errors.New("unauthorized")}
+	if value := providerValue(h, "example.com", "www", "www.example.com", "A"); value != "error: unauthorized" {
+		t.Errorf("the error should be shown, got %s", value)
+	}
+}
+
+func TestHasDrift(t *testing.T) {
+	tests := []struct {
+		name  string
+		row   drift
+		drift bool
+	}{
+		{"in sync", drift{Current: "203.0.113.20", Provider: "203.0.113.20", Authoritative: "203.0.113.20", Resolver: "203.0.113.20"}, false},
+		{"stale resolver", drift{Current: "203.0.113.20", Provider: "203.0.113.20", Authoritative: "203.0.113.20", Resolver: "198.51.100.7"}, true},
+		{"missing record", drift{Current: "203.0.113.20", Provider: "none", Authoritative: "203.0.113.20", Resolver: "203.0.113.20"}, true},
+		{"unreadable provider", drift{Current: "203.0.113.20", Provider: "n/a", Authoritative: "203.0.113.20", Resolver: "203.0.113.20"}, false},
+		{"failed lookup", drift{Current: "203.0.113.20", Provider: "203.0.113.20", Authoritative: "error: timeout", Resolver: "203.0.113.20"}, false},
+		{"unknown current IP", drift{Current: "error: no IP found", Provider: "203.0.113.20", Authoritative: "203.0.113.20", Resolver: "203.0.113.20"}, false},
+		{"round-robin member", drift{Current: "203.0.113.20", Provider: "198.51.100.7,203.0.113.20", Authoritative: "203.0.113.20,198.51.100.7", Resolver: "198.51.100.7,203.0.113.20", Member: true}, false},
+		{"missing member", drift{Current: "203.0.113.20", Provider: "198.51.100.7,203.0.113.20", Authoritative: "198.51.100.7", Resolver: "198.51.100.7,203.0.113.20", Member: true}, true},
+		{"not a member", drift{Current: "203.0.113.20", Provider: "198.51.100.7,203.0.113.20", Authoritative: "203.0.113.20", Resolver: "203.0.113.20"}, true},
+	}
+	for _, test := range tests {
+		if drift := hasDrift(test.row); drift != test.drift {
+			t.Errorf("%s: drift should be %t", test.name, test.drift)
+		}
+	}
+}
+
+func TestPrintDiffJSON(t *testing.T) {
+	defer func(output string) { *optOutput = output }(*optOutput)
+	*optOutput = "json"
+
+	var buf bytes.Buffer
+	printDiff(&buf, nil)
+	if buf.String() != "[]\n" {
+		t.Errorf("no rows should be an empty list, got %q", buf.String())
+	}
+
+	row := drift{Hostname: "www.example.com", Type: "A", Current: "203.0.113.20", Provider: "n/a", Authoritative: "203.0.113.20", Resolver: "198.51.100.7", Drift: true}
+	buf.Reset()
+	printDiff(&buf, []drift{row})
+
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"hostname":      "www.example.com",
+		"type":          "A",
+		"current":       "203.0.113.20",
+		"provider":      "n/a",
+		"authoritative": "203.0.113.20",
+		"resolver":      "198.51.100.7",
+		"drift":         true,
+	}
+	if len(decoded) != 1 || len(decoded[0]) != len(want) {
+		t.Fatalf("a single row with %d keys should be printed, got %s", len(want), buf.String())
+	}
+	for key, value := range want {
+		if decoded[0][key] != value {
+			t.Errorf("%s should be %v, got %v", key, value, decoded[0][key])
+		}
+	}
+}
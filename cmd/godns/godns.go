@@ -4,24 +4,30 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	"log"
-
+	"github.com/fatih/color"
 	"github.com/jmbayu/godns"
+	"github.com/jmbayu/godns/dyndns2"
 	"github.com/jmbayu/godns/handler"
-	"github.com/fatih/color"
+	"github.com/jmbayu/godns/server"
 )
 
 var (
 	configuration godns.Settings
 	optConf       = flag.String("c", "config.json", "Specify a config file")
 	optHelp       = flag.Bool("h", false, "Show help")
+	optOutput     = flag.String("o", "table", "Output format of the records and diff commands, table or json")
+	optTraceHTTP  = flag.String("trace-http", "", "Trace the HTTP requests to the providers and the notifiers, to the log with \"log\" or to a HAR file")
 
 	// Version is current version of GoDNS
 	Version = "0.1"
 )
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 	if *optHelp {
 		color.Cyan(godns.Logo, Version)
@@ -29,37 +35,169 @@ func main() {
 		return
 	}
 
+	// Commands which do not need a config file
+	switch flag.Arg(0) {
+	case "providers":
+		fmt.Print(godns.ProvidersMarkdown())
+		return
+	case "schema":
+		schema, err := godns.Schema()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		os.Stdout.Write(schema)
+		return
+	case "init":
+		initConfig()
+		return
+	}
+
 	// Load settings from configurations file
 	if err := godns.LoadSettings(*optConf, &configuration); err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
 
+	// Init log settings
+	if err := godns.SetupLogger(&configuration); err != nil {
+		fmt.Println("Cannot set up the logs:", err.Error())
+		os.Exit(1)
+	}
+	if *optTraceHTTP != "" {
+		if err := godns.TraceHTTP(*optTraceHTTP); err != nil {
+			fmt.Println("Cannot trace the HTTP requests:", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	switch flag.Arg(0) {
+	case "":
+		run()
+	case "serve":
+		serve()
+	case "check":
+		check()
+	case "records":
+		records(flag.Args()[1:])
+	case "diff":
+		diff()
+	default:
+		fmt.Println("Unknown command:", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s: [options] [command]\n\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "Commands:")
+	fmt.Fprintln(flag.CommandLine.Output(), "  (none)     keep the configured records up to date")
+	fmt.Fprintln(flag.CommandLine.Output(), "  serve      answer for the configured zone as an authoritative DNS server")
+	fmt.Fprintln(flag.CommandLine.Output(), "  init       write a config file from a few questions")
+	fmt.Fprintln(flag.CommandLine.Output(), "  check      check the settings, the credentials, the records and the notifications")
+	fmt.Fprintln(flag.CommandLine.Output(), "  records    records list <domain>, get <fqdn> or set <fqdn> <ip> at the provider")
+	fmt.Fprintln(flag.CommandLine.Output(), "  diff       compare the current IP with the provider, the name servers and the resolver")
+	fmt.Fprintln(flag.CommandLine.Output(), "  providers  document the supported providers in Markdown")
+	fmt.Fprintln(flag.CommandLine.Output(), "  schema     print the JSON Schema of the config file")
+	fmt.Fprintln(flag.CommandLine.Output(), "\nOptions:")
+	flag.PrintDefaults()
+
+	fmt.Fprintln(flag.CommandLine.Output(), "\nProviders:")
+	for _, provider := range godns.Providers() {
+		var details []string
+		if provider.Description != provider.Name {
+			details = append(details, provider.Description)
+		}
+		if capabilities := provider.Capabilities.String(); capabilities != "" {
+			details = append(details, "supports "+capabilities)
+		}
+		line := fmt.Sprintf("  %-11s %s", provider.Name, strings.Join(details, ", "))
+		fmt.Fprintln(flag.CommandLine.Output(), strings.TrimRight(line, " "))
+	}
+}
+
+func run() {
 	if err := godns.CheckSettings(&configuration); err != nil {
 		fmt.Println("Settings is invalid! ", err.Error())
 		os.Exit(1)
 	}
 
-	// Init log settings
-	log.SetPrefix("[GoDNS] ")
-	log.Println("GoDNS started, entering main loop...")
+	if configuration.DynDNS2Server.Enabled {
+		serveDynDNS2()
+	}
+
+	godns.Info("GoDNS started, entering main loop...")
 	dnsLoop()
 }
 
+func serveDynDNS2() {
+	if err := godns.CheckDynDNS2ServerSettings(&configuration); err != nil {
+		fmt.Println("Settings is invalid! ", err.Error())
+		os.Exit(1)
+	}
+
+	h := handler.CreateHandler(configuration.Provider)
+	h.SetConfiguration(&configuration)
+	setter, ok := h.(handler.IRecordSetter)
+	if !ok {
+		fmt.Println("Provider", configuration.Provider, "cannot be used with the dyndns2 server")
+		os.Exit(1)
+	}
+
+	s := dyndns2.NewServer(&configuration, setter)
+	go func() {
+		if err := s.ListenAndServe(); err != nil {
+			godns.Error("dyndns2 server stopped:", err)
+			os.Exit(1)
+		}
+	}()
+}
+
+func serve() {
+	if err := godns.CheckServerSettings(&configuration); err != nil {
+		fmt.Println("Settings is invalid! ", err.Error())
+		os.Exit(1)
+	}
+
+	s, err := server.New(&configuration)
+	if err != nil {
+		fmt.Println("Failed to create server: ", err.Error())
+		os.Exit(1)
+	}
+
+	go s.RefreshLoop()
+	if err := s.ListenAndServe(); err != nil {
+		godns.Error("Server stopped:", err)
+		os.Exit(1)
+	}
+}
+
 func dnsLoop() {
 	panicChan := make(chan godns.Domain)
 
-	log.Println("Creating DNS handler with provider:", configuration.Provider)
+	godns.Info("Creating DNS handler with provider:", configuration.Provider)
 	h := handler.CreateHandler(configuration.Provider)
 	h.SetConfiguration(&configuration)
-	for i := range configuration.Domains {
-		go h.DomainLoop(&configuration.Domains[i], panicChan)
+	if setter, ok := h.(handler.IMemberSetter); ok {
+		go withdrawOnExit(setter)
+	}
+
+	// the subdomains of each uplink get their own loop
+	domains := godns.SplitByIPSource(configuration.Domains)
+	for i := range domains {
+		// the domains without subdomains are only updated by the dyndns2
+		// server, on behalf of the routers
+		if len(domains[i].SubDomains) == 0 {
+			continue
+		}
+		go h.DomainLoop(&domains[i], panicChan)
 	}
 
 	panicCount := 0
 	for {
 		failDomain := <-panicChan
-		log.Println("Got panic in goroutine, will start a new one... :", panicCount)
+		godns.Warn("Got panic in goroutine, will start a new one... :", panicCount)
 		go h.DomainLoop(&failDomain, panicChan)
 
 		panicCount++
@@ -68,3 +206,22 @@ func dnsLoop() {
 		}
 	}
 }
+
+// withdrawOnExit removes the address of this host from the membership
+// records with withdraw_on_exit when GoDNS is interrupted or terminated
+func withdrawOnExit(setter handler.IMemberSetter) {
+	withdraw := false
+	for _, domain := range configuration.Domains {
+		withdraw = withdraw || (domain.WithdrawOnExit && len(domain.Membership) > 0)
+	}
+	if !withdraw {
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	godns.Info("Got", sig.String()+", withdrawing from the membership records...")
+	godns.WithdrawMembers(&configuration, setter)
+	os.Exit(0)
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jmbayu/godns"
+	"github.com/jmbayu/godns/handler"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultIPURL   = "https://myip.biturl.top"
+	defaultIPV6URL = "https://api-ipv6.ip.sb/ip"
+)
+
+// wizard asks the questions of the init command
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// initConfig writes the config file from the answers of the user
+func initConfig() {
+	path := *optConf
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+
+	if _, err := os.Stat(path); err == nil && !w.confirm(fmt.Sprintf("%s already exists, overwrite it?", path), false) {
+		return
+	}
+
+	config, err := w.run()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	content, err := encodeConfig(config, path)
+	if err != nil {
+		fmt.Println("Failed to encode the config:", err.Error())
+		os.Exit(1)
+	}
+	// the file holds credentials
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		fmt.Println("Failed to write the config:", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("\n%s written, try it with: godns -c %s check\n", path, path)
+}
+
+// run asks every question and returns the validated config document
+func (w *wizard) run() (map[string]interface{}, error) {
+	config := map[string]interface{}{}
+	if filepath.Ext(*optConf) == ".json" {
+		config["$schema"] = godns.SchemaURL
+	}
+
+	provider := w.provider()
+	config["provider"] = provider.Name
+	w.credentials(config, provider)
+
+	ipType := godns.IPV4
+	config["ip_type"] = "IPv4"
+	if provider.Capabilities.IPv6 && w.choose("IP version", []string{"IPv4", "IPv6"}) == 1 {
+		ipType = godns.IPV6
+		config["ip_type"] = "IPv6"
+	}
+
+	config["domains"] = w.domains(config, ipType)
+	w.ipSource(config, ipType)
+
+	interval, err := strconv.Atoi(w.ask("Seconds between two checks", "300"))
+	if err != nil || interval <= 0 {
+		interval = 300
+	}
+	config["interval"] = interval
+
+	if notify := w.notify(); len(notify) > 0 {
+		config["notify"] = notify
+	}
+
+	settings, err := decodeSettings(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := godns.CheckSettings(settings); err != nil {
+		return nil, fmt.Errorf("the config is invalid:\n%s", err)
+	}
+	return config, nil
+}
+
+// provider asks for the DNS provider
+func (w *wizard) provider() *godns.Provider {
+	providers := godns.Providers()
+	var options []string
+	for _, p := range providers {
+		option := p.Name
+		if p.Description != p.Name {
+			option += " (" + p.Description + ")"
+		}
+		options = append(options, option)
+	}
+	return providers[w.choose("DNS provider", options)]
+}
+
+// credentials asks for the credentials of provider, until they are valid
+func (w *wizard) credentials(config map[string]interface{}, provider *godns.Provider) {
+	fields := provider.CredentialFields()
+	if len(fields) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w.out, "\nSecrets can be given as env:NAME, file:/path or exec:command instead of their value.")
+	for {
+		block := map[string]interface{}{}
+		for _, field := range fields {
+			key := strings.TrimPrefix(field.Name, provider.ConfigKey+".")
+			if value := w.ask(fmt.Sprintf("%s, %s", field.Name, field.Description), ""); value != "" {
+				block[key] = value
+			}
+		}
+		config[provider.ConfigKey] = block
+
+		if provider.Validate == nil {
+			return
+		}
+		settings, err := decodeSettings(config)
+		if err == nil {
+			err = provider.Validate(settings)
+		}
+		if err == nil {
+			return
+		}
+		fmt.Fprintln(w.out, "Invalid credentials:", godns.RedactError(err))
+	}
+}
+
+// domains asks for the domains and subdomains, picked from the records of
+// the provider when it can list them
+func (w *wizard) domains(config map[string]interface{}, ipType string) []interface{} {
+	recordType := "A"
+	if ipType == godns.IPV6 {
+		recordType = "AAAA"
+	}
+
+	var lister handler.IRecordLister
+	if settings, err := decodeSettings(config); err == nil {
+		h := handler.CreateHandler(settings.Provider)
+		h.SetConfiguration(settings)
+		lister, _ = h.(handler.IRecordLister)
+	}
+
+	var zones []string
+	if lister != nil {
+		var err error
+		if zones, err = lister.ListZones(); err != nil {
+			fmt.Fprintln(w.out, "Cannot list the zones of the account:", godns.RedactError(err))
+		}
+	}
+
+	var domains []interface{}
+	if len(zones) > 0 {
+		for _, i := range w.chooseMany("Domains to update", zones) {
+			if subDomains := w.subDomains(lister, zones[i], recordType); len(subDomains) > 0 {
+				domains = append(domains, map[string]interface{}{"domain_name": zones[i], "sub_domains": subDomains})
+			}
+		}
+		if len(domains) > 0 {
+			return domains
+		}
+	}
+
+	for {
+		name := w.ask("Domain name, such as example.com", "")
+		subDomains := splitList(w.ask("Subdomains, separated by commas", "www"))
+		if name != "" && len(subDomains) > 0 {
+			domains = append(domains, map[string]interface{}{"domain_name": name, "sub_domains": subDomains})
+		}
+		if len(domains) > 0 && !w.confirm("Add another domain?", false) {
+			return domains
+		}
+	}
+}
+
+// subDomains asks for the subdomains of zone among its records of type
+// recordType
+func (w *wizard) subDomains(lister handler.IRecordLister, zone, recordType string) []string {
+	records, err := lister.ListRecords(zone)
+	if err != nil {
+		fmt.Fprintln(w.out, "Cannot list the records of", zone+":", godns.RedactError(err))
+	}
+
+	var names, options []string
+	for _, rec := range records {
+		if rec.Type != recordType || !strings.HasSuffix(rec.Name, "."+zone) {
+			continue
+		}
+		name := strings.TrimSuffix(rec.Name, "."+zone)
+		names = append(names, name)
+		options = append(options, fmt.Sprintf("%s (%s %s)", name, rec.Type, rec.Value))
+	}
+
+	if len(names) == 0 {
+		return splitList(w.ask(fmt.Sprintf("Subdomains of %s, separated by commas", zone), "www"))
+	}
+
+	var subDomains []string
+	for _, i := range w.chooseMany(fmt.Sprintf("Records of %s to update", zone), options) {
+		subDomains = append(subDomains, names[i])
+	}
+	return subDomains
+}
+
+// ipSource asks where the current IP is read from
+func (w *wizard) ipSource(config map[string]interface{}, ipType string) {
+	options := []string{"online service"}
+	var names []string
+	interfaces, _ := net.Interfaces()
+	for _, iface := range interfaces {
+		if ip := interfaceIP(iface, ipType); ip != "" {
+			options = append(options, fmt.Sprintf("interface %s (%s)", iface.Name, ip))
+			names = append(names, iface.Name)
+		}
+	}
+
+	if choice := w.choose("Read the current IP from", options); choice > 0 {
+		config["ip_interface"] = names[choice-1]
+		return
+	}
+
+	if ipType == godns.IPV6 {
+		config["ipv6_url"] = w.ask("URL returning the public IPv6 address", defaultIPV6URL)
+	} else {
+		config["ip_url"] = w.ask("URL returning the public IPv4 address", defaultIPURL)
+	}
+}
+
+// interfaceIP returns the first global address of iface of type ipType
+func interfaceIP(iface net.Interface, ipType string) string {
+	if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+		return ""
+	}
+
+	addrs, _ := iface.Addrs()
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if (ipNet.IP.To4() != nil) == (ipType == godns.IPV4) {
+			return ipNet.IP.String()
+		}
+	}
+	return ""
+}
+
+// notify asks for the notifications to enable
+func (w *wizard) notify() map[string]interface{} {
+	notify := map[string]interface{}{}
+
+	if w.confirm("Send Telegram notifications?", false) {
+		notify["telegram"] = map[string]interface{}{
+			"enabled":     true,
+			"bot_api_key": w.ask("Telegram bot API key", ""),
+			"chat_id":     w.ask("Telegram chat ID", ""),
+		}
+	}
+
+	if w.confirm("Send Slack notifications?", false) {
+		notify["slack"] = map[string]interface{}{
+			"enabled":       true,
+			"bot_api_token": w.ask("Slack bot API token", ""),
+			"channel":       w.ask("Slack channel", ""),
+		}
+	}
+
+	if w.confirm("Send email notifications?", false) {
+		port, _ := strconv.Atoi(w.ask("SMTP port", "587"))
+		notify["mail"] = map[string]interface{}{
+			"enabled":       true,
+			"smtp_server":   w.ask("SMTP server", ""),
+			"smtp_port":     port,
+			"smtp_username": w.ask("SMTP username", ""),
+			"smtp_password": w.ask("SMTP password", ""),
+			"send_to":       w.ask("Send the emails to", ""),
+		}
+	}
+
+	return notify
+}
+
+// ask returns the answer to question, or def when the answer is empty
+func (w *wizard) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+
+	line, err := w.in.ReadString('\n')
+	if err != nil && line == "" {
+		// no more answers, the wizard cannot go on
+		fmt.Fprintln(w.out)
+		os.Exit(1)
+	}
+
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+// confirm asks a yes or no question
+func (w *wizard) confirm(question string, def bool) bool {
+	answer := "y/N"
+	if def {
+		answer = "Y/n"
+	}
+
+	switch strings.ToLower(w.ask(question+" ("+answer+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// choose asks to pick one of options by number and returns its index
+func (w *wizard) choose(question string, options []string) int {
+	w.list(question, options)
+	for {
+		if n, err := strconv.Atoi(w.ask("Number", "1")); err == nil && n >= 1 && n <= len(options) {
+			return n - 1
+		}
+		fmt.Fprintln(w.out, "Please enter a number between 1 and", len(options))
+	}
+}
+
+// chooseMany asks to pick options by numbers separated by commas, all of
+// them by default, and returns their indexes
+func (w *wizard) chooseMany(question string, options []string) []int {
+	w.list(question, options)
+	for {
+		answer := w.ask("Numbers separated by commas, or all", "all")
+		if answer == "all" {
+			indexes := make([]int, len(options))
+			for i := range options {
+				indexes[i] = i
+			}
+			return indexes
+		}
+
+		indexes, err := parseNumbers(answer, len(options))
+		if err == nil {
+			return indexes
+		}
+		fmt.Fprintln(w.out, err)
+	}
+}
+
+func (w *wizard) list(question string, options []string) {
+	fmt.Fprintf(w.out, "\n%s:\n", question)
+	for i, option := range options {
+		fmt.Fprintf(w.out, "  %2d) %s\n", i+1, option)
+	}
+}
+
+// parseNumbers parses a list of numbers between 1 and max to indexes
+func parseNumbers(answer string, max int) ([]int, error) {
+	var indexes []int
+	for _, item := range splitList(answer) {
+		n, err := strconv.Atoi(item)
+		if err != nil || n < 1 || n > max {
+			return nil, fmt.Errorf("please enter numbers between 1 and %d", max)
+		}
+		indexes = append(indexes, n-1)
+	}
+	if len(indexes) == 0 {
+		return nil, errors.New("please choose at least one")
+	}
+	return indexes, nil
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// decodeSettings decodes the config document into settings, and registers
+// the secrets typed in for redaction
+func decodeSettings(config map[string]interface{}) (*godns.Settings, error) {
+	content, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &godns.Settings{}
+	if err := json.Unmarshal(content, settings); err != nil {
+		return nil, err
+	}
+	godns.RegisterSecrets(settings)
+	return settings, nil
+}
+
+// encodeConfig encodes the config document in the format of the extension
+// of path
+func encodeConfig(config map[string]interface{}, path string) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.Marshal(config)
+	case ".toml":
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(config); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		content, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(content, '\n'), nil
+	}
+}
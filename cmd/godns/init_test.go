@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jmbayu/godns"
+)
+
+func TestWizard(t *testing.T) {
+	// the providers are listed from 1, the compiled ones only
+	duck := ""
+	for i, provider := range godns.Providers() {
+		if provider.Name == godns.DUCK {
+			duck = strconv.Itoa(i + 1)
+		}
+	}
+	if duck == "" {
+		t.Skip("DuckDNS is not compiled in")
+	}
+
+	answers := []string{
+		duck,    // DuckDNS
+		"",      // no token, asked again
+		"token", // DuckDNS token
+		"1",     // IPv4
+		"example.com",
+		"www, home",
+		"n", // no other domain
+		"1", // online service
+		"",  // default IP URL
+		"60",
+		"y", // Telegram
+		"key",
+		"42",
+		"n", // no Slack
+		"n", // no email
+	}
+	w := &wizard{in: bufio.NewReader(strings.NewReader(strings.Join(answers, "\n") + "\n")), out: ioutil.Discard}
+
+	config, err := w.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := decodeSettings(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Provider != godns.DUCK || settings.DuckDNS.Token != "token" {
+		t.Errorf("DuckDNS should be configured with its token, got %+v", settings)
+	}
+	if len(settings.Domains) != 1 || strings.Join(settings.Domains[0].SubDomains, ",") != "www,home" {
+		t.Errorf("example.com should be configured with www and home, got %+v", settings.Domains)
+	}
+	if settings.IPUrl != defaultIPURL || settings.Interval != 60 {
+		t.Errorf("IP source and interval should be configured, got %s and %d", settings.IPUrl, settings.Interval)
+	}
+	if !settings.Notify.Telegram.Enabled || settings.Notify.Telegram.ChatId != "42" {
+		t.Errorf("Telegram should be enabled, got %+v", settings.Notify.Telegram)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jmbayu/godns"
+	"github.com/jmbayu/godns/handler"
+)
+
+// records inspects and overrides the records of the configured provider:
+// records list <domain>, records get <fqdn> and records set <fqdn> <ip>
+func records(args []string) {
+	if err := godns.CheckSettings(&configuration); err != nil {
+		fmt.Println("Settings is invalid! ", err.Error())
+		os.Exit(1)
+	}
+
+	h := handler.CreateHandler(configuration.Provider)
+	h.SetConfiguration(&configuration)
+
+	var list []godns.Record
+	var err error
+	switch {
+	case len(args) == 2 && args[0] == "list":
+		list, err = listRecords(h, strings.TrimSuffix(args[1], "."))
+	case len(args) == 2 && args[0] == "get":
+		list, err = getRecords(h, strings.TrimSuffix(args[1], "."))
+	case len(args) == 3 && args[0] == "set":
+		list, err = setRecord(h, strings.TrimSuffix(args[1], "."), args[2])
+	default:
+		fmt.Println("Usage: godns records list <domain> | get <fqdn> | set <fqdn> <ip>")
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Println(godns.Redact(err.Error()))
+		os.Exit(1)
+	}
+	printRecords(list)
+}
+
+func listRecords(h handler.IHandler, domain string) ([]godns.Record, error) {
+	lister, ok := h.(handler.IRecordLister)
+	if !ok {
+		return nil, fmt.Errorf("provider %s cannot list records", configuration.Provider)
+	}
+	return lister.ListRecords(domain)
+}
+
+func getRecords(h handler.IHandler, fqdn string) ([]godns.Record, error) {
+	domain, subDomain, err := splitHostname(h, fqdn)
+	if err != nil {
+		return nil, err
+	}
+
+	if getter, ok := h.(handler.IRecordGetter); ok {
+		return getter.GetRecords(domain, subDomain)
+	}
+
+	all, err := listRecords(h, domain)
+	if err != nil {
+		return nil, err
+	}
+	var list []godns.Record
+	for _, rec := range all {
+		if strings.EqualFold(rec.Name, fqdn) {
+			list = append(list, rec)
+		}
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no record found for %s", fqdn)
+	}
+	return list, nil
+}
+
+func setRecord(h handler.IHandler, fqdn, ip string) ([]godns.Record, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+
+	setter, ok := h.(handler.IRecordSetter)
+	if !ok {
+		return nil, fmt.Errorf("provider %s cannot set records", configuration.Provider)
+	}
+
+	domain, subDomain, err := splitHostname(h, fqdn)
+	if err != nil {
+		return nil, err
+	}
+
+	// the handlers set the record of the type of ip_type
+	record := godns.Record{Name: fqdn, Type: "A", Value: ip}
+	configuration.IPType = godns.IPV4
+	if addr.To4() == nil {
+		if provider, _ := godns.LookupProvider(configuration.Provider); !provider.Capabilities.IPv6 {
+			return nil, fmt.Errorf("provider %s does not support IPv6", configuration.Provider)
+		}
+		record.Type = "AAAA"
+		configuration.IPType = godns.IPV6
+	}
+
+	if err := setter.SetRecord(domain, subDomain, ip); err != nil {
+		return nil, err
+	}
+	return []godns.Record{record}, nil
+}
+
+// splitHostname splits fqdn into its domain and subdomain, the domain is
+// one of the configured domains or one of the zones of the account. The
+// subdomain of the domain itself is @.
+func splitHostname(h handler.IHandler, fqdn string) (string, string, error) {
+	var domains []string
+	for _, domain := range configuration.Domains {
+		domains = append(domains, domain.DomainName)
+	}
+	if lister, ok := h.(handler.IRecordLister); ok {
+		zones, _ := lister.ListZones()
+		domains = append(domains, zones...)
+	}
+
+	best := ""
+	for _, domain := range domains {
+		domain = strings.TrimSuffix(domain, ".")
+		if strings.EqualFold(fqdn, domain) {
+			return domain, "@", nil
+		}
+		if strings.HasSuffix(strings.ToLower(fqdn), "."+strings.ToLower(domain)) && len(domain) > len(best) {
+			best = domain
+		}
+	}
+	if best == "" {
+		return "", "", errors.New("cannot find the domain of " + fqdn + ", add it to the domains of the config")
+	}
+	return best, fqdn[:len(fqdn)-len(best)-1], nil
+}
+
+// printRecords prints records as a table, or in JSON with -o json
+func printRecords(records []godns.Record) {
+	if *optOutput == "json" {
+		if records == nil {
+			records = []godns.Record{}
+		}
+		content, _ := json.MarshalIndent(records, "", "  ")
+		fmt.Println(string(content))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tVALUE\tTTL")
+	for _, rec := range records {
+		ttl := ""
+		if rec.TTL > 0 {
+			ttl = fmt.Sprint(rec.TTL)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", rec.Name, rec.Type, rec.Value, ttl)
+	}
+	w.Flush()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jmbayu/godns"
+)
+
+func TestSplitHostname(t *testing.T) {
+	defer func(settings godns.Settings) { configuration = settings }(configuration)
+	configuration = godns.Settings{Domains: []godns.Domain{{DomainName: "example.com"}, {DomainName: "home.example.com"}}}
+
+	cases := []struct {
+		fqdn, domain, subDomain string
+	}{
+		{"www.example.com", "example.com", "www"},
+		{"example.com", "example.com", "@"},
+		{"Example.COM", "example.com", "@"},
+		{"nas.home.example.com", "home.example.com", "nas"},
+		{"home.example.com", "home.example.com", "@"},
+		{"a.b.example.com", "example.com", "a.b"},
+	}
+	for _, c := range cases {
+		domain, subDomain, err := splitHostname(updateOnlyHandler{}, c.fqdn)
+		if err != nil || domain != c.domain || subDomain != c.subDomain {
+			t.Errorf("%s should be split into %s and %s, got %s and %s, %v", c.fqdn, c.subDomain, c.domain, subDomain, domain, err)
+		}
+	}
+
+	if _, _, err := splitHostname(updateOnlyHandler{}, "example.net"); err == nil {
+		t.Error("a hostname outside of the domains should fail")
+	}
+}
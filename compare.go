@@ -0,0 +1,96 @@
+package godns
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// CompareDNS compares the current IP with the one returned by the resolver
+	CompareDNS = "dns"
+	// CompareProviderAPI compares the current IP with the record read through the provider API
+	CompareProviderAPI = "provider_api"
+	// CompareLocalState compares the current IP with the last one GoDNS set
+	CompareLocalState = "local_state"
+)
+
+// CompareStrategy returns the sources used to decide whether the records of
+// domain are stale: the domain setting, then the global one, then defaults
+func CompareStrategy(configuration *Settings, domain *Domain, defaults ...string) []string {
+	if len(domain.CompareWith) > 0 {
+		return domain.CompareWith
+	}
+	if len(configuration.CompareWith) > 0 {
+		return configuration.CompareWith
+	}
+	return defaults
+}
+
+// NeedsUpdate reports whether hostname has to be updated to currentIP.
+// The sources of the compare_with strategy are consulted in order, and the
+// record is up to date as soon as one of them returns currentIP; a source
+// that fails counts as a mismatch. providerValue reads the record through
+// the provider API, it is nil for providers which cannot read records.
+// defaults is the strategy of the handler when none is configured.
+func NeedsUpdate(configuration *Settings, domain *Domain, hostname, currentIP string, providerValue ReadBackFunc, defaults ...string) bool {
+	strategy := CompareStrategy(configuration, domain, defaults...)
+
+	stale, compared := compare(configuration, hostname, currentIP, providerValue, strategy)
+	if !compared {
+		// nothing usable has been configured, fall back to the resolver
+		stale, _ = compare(configuration, hostname, currentIP, nil, []string{CompareDNS})
+	}
+
+	return stale
+}
+
+func compare(configuration *Settings, hostname, currentIP string, providerValue ReadBackFunc, strategy []string) (bool, bool) {
+	compared := false
+	for _, source := range strategy {
+		var value string
+		var err error
+
+		switch source {
+		case CompareDNS:
+			value, err = ResolveDNS(hostname, configuration.Resolver, configuration.IPType)
+		case CompareProviderAPI:
+			if providerValue == nil {
+				Warnf("Provider %s cannot read records, ignoring %s for %s", configuration.Provider, source, hostname)
+				continue
+			}
+			value, err = providerValue()
+		case CompareLocalState:
+			state, ok := GetStateStore(configuration).Get(hostname)
+			if !ok {
+				err = fmt.Errorf("no local state for %s", hostname)
+			}
+			value = state.IP
+		default:
+			Warnf("Unknown compare_with source %s, ignoring it", source)
+			continue
+		}
+		compared = true
+
+		if err != nil {
+			Errorf("Cannot compare %s with %s: %s", hostname, source, err)
+			continue
+		}
+
+		if strings.TrimSpace(value) == currentIP {
+			Infof("IP of %s is the same as %s. Skip update.", hostname, source)
+			return false, true
+		}
+		Warnf("IP mismatch for %s: current(%s) vs %s(%s)", hostname, currentIP, source, value)
+	}
+
+	return true, compared
+}
+
+// ValidCompareSource reports whether source is a known compare_with value
+func ValidCompareSource(source string) bool {
+	switch source {
+	case CompareDNS, CompareProviderAPI, CompareLocalState:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package godns
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNeedsUpdate(t *testing.T) {
+	conf := &Settings{StatePath: ""}
+	domain := &Domain{DomainName: "example.com", CompareWith: []string{CompareLocalState, CompareProviderAPI}}
+	GetStateStore(conf).SetIP("www.example.com", "1.1.1.1")
+
+	calls := 0
+	provider := func(ip string, err error) ReadBackFunc {
+		return func() (string, error) {
+			calls++
+			return ip, err
+		}
+	}
+
+	if NeedsUpdate(conf, domain, "www.example.com", "1.1.1.1", provider("2.2.2.2", nil)) {
+		t.Error("local state matches, should not need update")
+	}
+	if calls != 0 {
+		t.Error("provider should not be queried when the local state matches")
+	}
+
+	if NeedsUpdate(conf, domain, "www.example.com", "2.2.2.2", provider("2.2.2.2", nil)) {
+		t.Error("provider matches, should not need update")
+	}
+
+	if !NeedsUpdate(conf, domain, "www.example.com", "3.3.3.3", provider("2.2.2.2", nil)) {
+		t.Error("no source matches, should need update")
+	}
+
+	if !NeedsUpdate(conf, domain, "www.example.com", "3.3.3.3", provider("", errors.New("failed"))) {
+		t.Error("failed source counts as mismatch, should need update")
+	}
+}
@@ -0,0 +1,245 @@
+package godns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding settings
+const EnvPrefix = "GODNS_"
+
+// readConfig parses the config file at path, in JSON, YAML or TOML
+// depending on its extension, into a generic document
+func readConfig(path string) (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var doc interface{}
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			return config, nil
+		}
+		converted, ok := convertYAML(doc).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must contain a mapping", path)
+		}
+		return converted, nil
+	case ".toml":
+		if _, err := toml.Decode(string(content), &config); err != nil {
+			return nil, err
+		}
+	default:
+		if err := json.Unmarshal(content, &config); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+// convertYAML turns the mappings decoded by yaml into JSON objects
+func convertYAML(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range t {
+			m[fmt.Sprint(key)] = convertYAML(value)
+		}
+		return m
+	case []interface{}:
+		for i := range t {
+			t[i] = convertYAML(t[i])
+		}
+	}
+	return v
+}
+
+// envOverrides returns the GODNS_ variables of environ
+func envOverrides(environ []string) map[string]string {
+	overrides := map[string]string{}
+	for _, env := range environ {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], EnvPrefix) {
+			overrides[parts[0]] = parts[1]
+		}
+	}
+	return overrides
+}
+
+// applyEnvOverrides sets the settings named by GODNS_ variables in config.
+// The name is the upper-cased path of the setting, with _ between the
+// fields and the indexes, such as GODNS_DOMAINS_0_SUB_DOMAINS. Lists are
+// separated by commas, and objects or lists of objects are given in JSON.
+func applyEnvOverrides(config map[string]interface{}, overrides map[string]string) error {
+	for name, value := range overrides {
+		path := strings.TrimPrefix(name, EnvPrefix)
+		if err := setOverride(config, reflect.TypeOf(Settings{}), path, value); err != nil {
+			if err == errNoSetting {
+				Warnf("%s does not match any setting, ignored", name)
+				continue
+			}
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+var errNoSetting = fmt.Errorf("no such setting")
+
+// setOverride sets the value of the setting at path, path is matched against
+// the json fields of t
+func setOverride(doc map[string]interface{}, t reflect.Type, path, value string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := jsonName(field)
+		if key == "" {
+			continue
+		}
+
+		envKey := strings.ToUpper(key)
+		if path == envKey {
+			parsed, err := parseOverride(field.Type, value)
+			if err != nil {
+				return err
+			}
+			doc[key] = parsed
+			return nil
+		}
+		if !strings.HasPrefix(path, envKey+"_") {
+			continue
+		}
+
+		rest := strings.TrimPrefix(path, envKey+"_")
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			child, _ := doc[key].(map[string]interface{})
+			if child == nil {
+				child = map[string]interface{}{}
+			}
+			if err := setOverride(child, field.Type, rest, value); err != nil {
+				if err == errNoSetting {
+					continue
+				}
+				return err
+			}
+			doc[key] = child
+			return nil
+
+		case reflect.Map:
+			child, _ := doc[key].(map[string]interface{})
+			if child == nil {
+				child = map[string]interface{}{}
+			}
+			parsed, err := parseOverride(field.Type.Elem(), value)
+			if err != nil {
+				return err
+			}
+			child[strings.ToLower(rest)] = parsed
+			doc[key] = child
+			return nil
+
+		case reflect.Slice:
+			if field.Type.Elem().Kind() != reflect.Struct {
+				continue
+			}
+			parts := strings.SplitN(rest, "_", 2)
+			index, err := strconv.Atoi(parts[0])
+			if err != nil || len(parts) != 2 {
+				continue
+			}
+
+			list, _ := doc[key].([]interface{})
+			for len(list) <= index {
+				list = append(list, map[string]interface{}{})
+			}
+			child, _ := list[index].(map[string]interface{})
+			if child == nil {
+				child = map[string]interface{}{}
+			}
+			if err := setOverride(child, field.Type.Elem(), parts[1], value); err != nil {
+				if err == errNoSetting {
+					continue
+				}
+				return err
+			}
+			list[index] = child
+			doc[key] = list
+			return nil
+		}
+	}
+
+	return errNoSetting
+}
+
+// parseOverride converts the value of a variable to the JSON value of a
+// setting of type t
+func parseOverride(t reflect.Type, value string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return value, nil
+	case reflect.Bool:
+		return strconv.ParseBool(value)
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return strconv.Atoi(value)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			var list []interface{}
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			return list, nil
+		}
+		if t.Elem().Kind() == reflect.Int {
+			var list []interface{}
+			for _, item := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(strings.TrimSpace(item))
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, n)
+			}
+			return list, nil
+		}
+	}
+
+	// objects, lists of objects and raw JSON settings
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		return nil, fmt.Errorf("value must be JSON: %s", err)
+	}
+	return parsed, nil
+}
+
+// decodeConfig decodes the generic document into settings
+func decodeConfig(config map[string]interface{}, settings *Settings) error {
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, settings)
+}
+
+// configExists reports whether the config file at path exists, GoDNS can
+// run from GODNS_ variables alone when it does not
+func configExists(path string) bool {
+	_, err := os.Stat(path)
+	return !os.IsNotExist(err)
+}
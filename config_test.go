@@ -0,0 +1,130 @@
+package godns
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadSettingsFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"config.yaml": `
+# comments are allowed
+provider: DNSPod
+domains:
+  - domain_name: example.com
+    sub_domains: [www, test]
+notify:
+  telegram:
+    message_template: |
+      Domain {{ .Domain }}
+      is updated
+`,
+		"config.toml": `
+provider = "DNSPod"
+
+[[domains]]
+domain_name = "example.com"
+sub_domains = ["www", "test"]
+
+[notify.telegram]
+message_template = """Domain {{ .Domain }}
+is updated
+"""
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		ioutil.WriteFile(path, []byte(content), 0600)
+
+		var settings Settings
+		if err := LoadSettings(path, &settings); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if settings.Provider != "DNSPod" || len(settings.Domains) != 1 ||
+			!reflect.DeepEqual(settings.Domains[0].SubDomains, []string{"www", "test"}) {
+			t.Errorf("%s: unexpected settings %+v", name, settings)
+		}
+		if settings.Notify.Telegram.MsgTemplate != "Domain {{ .Domain }}\nis updated\n" {
+			t.Errorf("%s: unexpected template %q", name, settings.Notify.Telegram.MsgTemplate)
+		}
+	}
+}
+
+func TestLoadSettingsSample(t *testing.T) {
+	var settings Settings
+	if err := LoadSettings("./config_sample.yaml", &settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings.IPUrl == "" || len(settings.Domains) != 2 {
+		t.Errorf("cannot load config_sample.yaml, got %+v", settings)
+	}
+}
+
+func TestLoadSettingsEnv(t *testing.T) {
+	env := map[string]string{
+		"GODNS_PROVIDER":                  "Cloudflare",
+		"GODNS_CLOUDFLARE_API_TOKEN":      "cf-api-token",
+		"GODNS_DOMAINS_0_DOMAIN_NAME":     "example.com",
+		"GODNS_DOMAINS_0_SUB_DOMAINS":     "www, test",
+		"GODNS_INTERVAL":                  "60",
+		"GODNS_NOTIFY_MAIL_ENABLED":       "true",
+		"GODNS_SERVER_UPDATE_KEYS_ROUTER": "c2VjcmV0",
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	var settings Settings
+	if err := LoadSettings("./file/does/not/exists", &settings); err != nil {
+		t.Fatal(err)
+	}
+
+	if settings.Provider != "Cloudflare" || settings.Cloudflare.APIToken != "cf-api-token" || settings.Interval != 60 {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+	if len(settings.Domains) != 1 || settings.Domains[0].DomainName != "example.com" ||
+		!reflect.DeepEqual(settings.Domains[0].SubDomains, []string{"www", "test"}) {
+		t.Errorf("unexpected domains %+v", settings.Domains)
+	}
+	if !settings.Notify.Mail.Enabled || settings.Server.UpdateKeys["router"] != "c2VjcmV0" {
+		t.Errorf("nested settings should be overridden, got %+v", settings)
+	}
+
+	// variables override the config file
+	settings = Settings{}
+	if err := LoadSettings("./config_sample.json", &settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Provider != "Cloudflare" || settings.IPUrl == "" {
+		t.Errorf("variables should override the config file, got %+v", settings)
+	}
+}
+
+func TestLoadSettingsEnvInvalid(t *testing.T) {
+	os.Setenv("GODNS_UNKNOWN_SETTING", "ignored")
+	defer os.Unsetenv("GODNS_UNKNOWN_SETTING")
+	os.Setenv("GODNS_INTERVAL", "abc")
+	defer os.Unsetenv("GODNS_INTERVAL")
+
+	var settings Settings
+	if err := LoadSettings("./config_sample.json", &settings); err == nil || !strings.HasPrefix(err.Error(), "GODNS_INTERVAL: ") {
+		t.Errorf("a value which does not parse should fail, got %v", err)
+	}
+
+	os.Unsetenv("GODNS_INTERVAL")
+	if err := LoadSettings("./config_sample.json", &settings); err != nil {
+		t.Errorf("a variable which matches no setting should be ignored, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package dyndns2
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmbayu/godns"
+)
+
+// Backoff is how long the client waits after a 911 or dnserr reply, as
+// required by the protocol
+var Backoff = 30 * time.Minute
+
+// ErrBackingOff is returned while the client waits after a server error
+var ErrBackingOff = errors.New("server asked to back off, update postponed")
+
+// Result is the parsed reply for one hostname
+type Result struct {
+	Code Code
+	IP   string
+}
+
+// Error is returned for a reply which is not good or nochg
+type Error struct {
+	Hostname string
+	Code     Code
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("update of %s failed: %s", e.Hostname, e.Code)
+}
+
+// Client updates hostnames on a dyndns2 compatible service
+type Client struct {
+	// URL is the update endpoint, such as https://members.dyndns.org/nic/update
+	URL       string
+	Username  string
+	Password  string
+	UserAgent string
+	// IPv6Param is the query parameter of IPv6 addresses, myip when empty
+	IPv6Param  string
+	HTTPClient *http.Client
+
+	mu          sync.Mutex
+	suspended   map[string]Code
+	account     Code
+	backoffTill time.Time
+}
+
+// NewClient creates a client for the update endpoint url
+func NewClient(url, username, password string, httpClient *http.Client) *Client {
+	// the credentials are sent in the Authorization header
+	godns.RegisterBasicAuth(username, password)
+	return &Client{
+		URL:        url,
+		Username:   username,
+		Password:   password,
+		HTTPClient: httpClient,
+		suspended:  map[string]Code{},
+	}
+}
+
+// Suspended returns the fatal code which suspended hostname, if any
+func (c *Client) Suspended(hostname string) (Code, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.account != "" {
+		return c.account, true
+	}
+	code, ok := c.suspended[hostname]
+	return code, ok
+}
+
+// Update points hostname to ip. Hostnames suspended by a fatal reply are
+// never sent again, and no request is sent while backing off.
+func (c *Client) Update(hostname, ip string) (*Result, error) {
+	if code, ok := c.Suspended(hostname); ok {
+		return nil, &Error{Hostname: hostname, Code: code}
+	}
+
+	c.mu.Lock()
+	backoffTill := c.backoffTill
+	c.mu.Unlock()
+	if time.Now().Before(backoffTill) {
+		return nil, ErrBackingOff
+	}
+
+	req, err := c.request(hostname, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := Parse(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("unexpected reply with status %d: %s", resp.StatusCode, err)
+	}
+
+	c.handle(hostname, result.Code, resp.Header.Get("Retry-After"))
+	if !result.Code.Success() {
+		return result, &Error{Hostname: hostname, Code: result.Code}
+	}
+	return result, nil
+}
+
+func (c *Client) request(hostname, ip string) (*http.Request, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	param := "myip"
+	if c.IPv6Param != "" && strings.Contains(ip, ":") {
+		param = c.IPv6Param
+	}
+	query := u.Query()
+	query.Set("hostname", hostname)
+	query.Set(param, ip)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	return req, nil
+}
+
+// handle suspends hostnames and backs off according to code
+func (c *Client) handle(hostname string, code Code, retryAfter string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case code.Fatal() && code.AccountWide():
+		logger.Errorf("dyndns2 account %s suspended: %s, fix the configuration and restart GoDNS", c.Username, code)
+		c.account = code
+	case code.Fatal():
+		if c.suspended == nil {
+			c.suspended = map[string]Code{}
+		}
+		logger.Errorf("%s suspended: %s, fix the configuration and restart GoDNS", hostname, code)
+		c.suspended[hostname] = code
+	case code.Retry():
+		wait := Backoff
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && time.Duration(seconds)*time.Second > wait {
+			wait = time.Duration(seconds) * time.Second
+		}
+		logger.Warnf("dyndns2 server replied %s, backing off for %s", code, wait)
+		c.backoffTill = time.Now().Add(wait)
+	}
+}
+
+// Parse parses the reply to a single hostname update
+func Parse(body string) (*Result, error) {
+	fields := strings.Fields(body)
+	if len(fields) == 0 {
+		return nil, errors.New("empty reply")
+	}
+
+	result := &Result{Code: Code(fields[0])}
+	if !result.Code.Known() {
+		return nil, fmt.Errorf("unknown return code %q", fields[0])
+	}
+	if len(fields) > 1 {
+		result.IP = fields[1]
+	}
+	return result, nil
+}
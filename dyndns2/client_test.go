@@ -0,0 +1,83 @@
+package dyndns2
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientUpdate(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			fmt.Fprint(w, "badauth")
+			return
+		}
+		switch r.URL.Query().Get("hostname") {
+		case "good.example.com":
+			fmt.Fprint(w, "good ", r.URL.Query().Get("myip"))
+		case "same.example.com":
+			fmt.Fprint(w, "nochg ", r.URL.Query().Get("myip"))
+		case "busy.example.com":
+			fmt.Fprint(w, "911")
+		default:
+			fmt.Fprint(w, "nohost")
+		}
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL+"/nic/update", "user", "pass", nil)
+
+	result, err := client.Update("good.example.com", "192.0.2.1")
+	if err != nil || result.Code != Good || result.IP != "192.0.2.1" {
+		t.Errorf("update should be good, got %v (%v)", result, err)
+	}
+	if result, err = client.Update("same.example.com", "192.0.2.1"); err != nil || result.Code != NoChg {
+		t.Errorf("update should be nochg, got %v (%v)", result, err)
+	}
+
+	if _, err = client.Update("missing.example.com", "192.0.2.1"); err == nil {
+		t.Error("nohost should be an error")
+	}
+	sent := requests
+	if _, err = client.Update("missing.example.com", "192.0.2.1"); err == nil || requests != sent {
+		t.Error("a hostname suspended by nohost should not be sent again")
+	}
+	if code, ok := client.Suspended("missing.example.com"); !ok || code != NoHost {
+		t.Errorf("missing.example.com should be suspended by nohost, got %q", code)
+	}
+
+	if _, err = client.Update("busy.example.com", "192.0.2.1"); err == nil {
+		t.Error("911 should be an error")
+	}
+	sent = requests
+	if _, err = client.Update("good.example.com", "192.0.2.1"); err != ErrBackingOff || requests != sent {
+		t.Errorf("client should back off after 911, got %v", err)
+	}
+}
+
+func TestClientBadAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "badauth")
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, "user", "wrong", nil)
+	if _, err := client.Update("a.example.com", "192.0.2.1"); err == nil {
+		t.Error("badauth should be an error")
+	}
+	if _, ok := client.Suspended("b.example.com"); !ok {
+		t.Error("badauth should suspend every hostname of the account")
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse("<html>oops</html>"); err == nil {
+		t.Error("unknown replies should be rejected")
+	}
+	if result, err := Parse("nochg 2001:db8::1\n"); err != nil || result.Code != NoChg || result.IP != "2001:db8::1" {
+		t.Errorf("nochg reply should be parsed, got %v (%v)", result, err)
+	}
+}
@@ -0,0 +1,67 @@
+package dyndns2
+
+// Code is a return code of the dyndns2 protocol
+type Code string
+
+const (
+	// Good the update was successful
+	Good Code = "good"
+	// NoChg the hostname already pointed to the address
+	NoChg Code = "nochg"
+	// BadAuth the username and password pair do not match
+	BadAuth Code = "badauth"
+	// NotFQDN the hostname is not a fully-qualified domain name
+	NotFQDN Code = "notfqdn"
+	// NoHost the hostname does not exist, or is not allowed for the user
+	NoHost Code = "nohost"
+	// NumHost too many hosts were specified in the request
+	NumHost Code = "numhost"
+	// Abuse the hostname is blocked for update abuse
+	Abuse Code = "abuse"
+	// BadAgent the user agent was not sent or is blocked
+	BadAgent Code = "badagent"
+	// NotDonator an option of the request is only available to paying users
+	NotDonator Code = "!donator"
+	// DNSErr a DNS error was encountered
+	DNSErr Code = "dnserr"
+	// ServerError there is a problem on the server side
+	ServerError Code = "911"
+)
+
+// MaxHosts is the number of hostnames a single request may update
+const MaxHosts = 20
+
+// Known reports whether c is a return code of the protocol
+func (c Code) Known() bool {
+	switch c {
+	case Good, NoChg, BadAuth, NotFQDN, NoHost, NumHost, Abuse, BadAgent, DNSErr, ServerError, NotDonator:
+		return true
+	}
+	return false
+}
+
+// Success reports whether the hostname points to the requested address
+func (c Code) Success() bool {
+	return c == Good || c == NoChg
+}
+
+// Fatal reports whether the request must not be retried until the
+// configuration is fixed
+func (c Code) Fatal() bool {
+	switch c {
+	case BadAuth, NotFQDN, NoHost, NumHost, Abuse, BadAgent, NotDonator:
+		return true
+	}
+	return false
+}
+
+// AccountWide reports whether the code applies to every hostname of the
+// account rather than to the requested one
+func (c Code) AccountWide() bool {
+	return c == BadAuth || c == BadAgent
+}
+
+// Retry reports whether the server asked to back off before the next request
+func (c Code) Retry() bool {
+	return c == ServerError || c == DNSErr
+}
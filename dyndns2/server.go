@@ -0,0 +1,224 @@
+package dyndns2
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jmbayu/godns"
+)
+
+// DefaultListen is the address of the server when none is configured
+const DefaultListen = ":8080"
+
+// logger logs the client and the server with the component field
+var logger = godns.WithFields(godns.Fields{"component": "dyndns2"})
+
+// RecordSetter sets a single record through a provider, it is implemented
+// by the provider handlers
+type RecordSetter interface {
+	SetRecord(domain, subDomain, ip string) error
+}
+
+// Server accepts dyndns2 updates, such as the ones sent by routers and NAS
+// boxes, and forwards them to the handler of the configured provider
+type Server struct {
+	Configuration *godns.Settings
+	Setter        RecordSetter
+}
+
+// NewServer creates a dyndns2 server updating the records through setter
+func NewServer(configuration *godns.Settings, setter RecordSetter) *Server {
+	return &Server{Configuration: configuration, Setter: setter}
+}
+
+// ListenAndServe serves the /nic/update endpoint, over TLS when a
+// certificate is configured
+func (s *Server) ListenAndServe() error {
+	conf := s.Configuration.DynDNS2Server
+
+	listen := conf.Listen
+	if listen == "" {
+		listen = DefaultListen
+	}
+
+	server := &http.Server{Addr: listen, Handler: s.Handler()}
+
+	logger.Info("dyndns2 server listening on", listen)
+	if conf.TLSCert != "" {
+		return server.ListenAndServeTLS(conf.TLSCert, conf.TLSKey)
+	}
+	return server.ListenAndServe()
+}
+
+// Handler routes the /nic/update endpoint to the server
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/nic/update", s)
+	return mux
+}
+
+// ServeHTTP handles a single update request, answering one return code per
+// requested hostname
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+
+	client := s.authenticate(r)
+	if client == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="GoDNS"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, BadAuth)
+		return
+	}
+
+	query := r.URL.Query()
+	var hostnames []string
+	for _, hostname := range strings.Split(query.Get("hostname"), ",") {
+		if hostname = strings.TrimSpace(hostname); hostname != "" {
+			hostnames = append(hostnames, strings.ToLower(strings.TrimSuffix(hostname, ".")))
+		}
+	}
+	if len(hostnames) == 0 {
+		fmt.Fprintln(w, NotFQDN)
+		return
+	}
+	if len(hostnames) > MaxHosts {
+		fmt.Fprintln(w, NumHost)
+		return
+	}
+
+	ip := s.requestIP(r)
+	for _, hostname := range hostnames {
+		code := s.update(client, hostname, ip)
+		if code == Good || code == NoChg {
+			fmt.Fprintf(w, "%s %s\n", code, ip)
+		} else {
+			fmt.Fprintln(w, code)
+		}
+	}
+}
+
+// update sets hostname to ip on behalf of client
+func (s *Server) update(client *godns.DynDNS2Client, hostname, ip string) Code {
+	if !strings.Contains(hostname, ".") {
+		return NotFQDN
+	}
+	if !Allowed(client, hostname) {
+		logger.Warnf("dyndns2 client %s is not allowed to update %s", client.Username, hostname)
+		return NoHost
+	}
+
+	domain, subDomain := s.findDomain(hostname)
+	if domain == nil {
+		logger.Info("No configured domain owns", hostname)
+		return NoHost
+	}
+
+	if ip == "" {
+		logger.Warnf("dyndns2 request for %s has no %s address", hostname, s.Configuration.IPType)
+		return DNSErr
+	}
+
+	if !godns.NeedsUpdate(s.Configuration, domain, hostname, ip, nil, godns.CompareLocalState) {
+		return NoChg
+	}
+
+	logger.Infof("dyndns2 client %s updates %s to %s", client.Username, hostname, ip)
+	if err := s.Setter.SetRecord(domain.DomainName, subDomain, ip); err != nil {
+		logger.Error("Failed to update the record:", err)
+		return DNSErr
+	}
+
+	// Send notification
+	if err := godns.SendNotify(s.Configuration, hostname, ip); err != nil {
+		logger.Error("Failed to send notification")
+	}
+
+	godns.RecordUpdated(s.Configuration, hostname, ip, nil)
+	return Good
+}
+
+// authenticate returns the client matching the basic auth credentials of r
+func (s *Server) authenticate(r *http.Request) *godns.DynDNS2Client {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+
+	clients := s.Configuration.DynDNS2Server.Clients
+	for i := range clients {
+		if clients[i].Username == username &&
+			subtle.ConstantTimeCompare([]byte(clients[i].Password), []byte(password)) == 1 {
+			return &clients[i]
+		}
+	}
+	return nil
+}
+
+// requestIP returns the address of the request matching the configured IP
+// type, read from myip (which may list both families), myipv6, and finally
+// the address of the client itself
+func (s *Server) requestIP(r *http.Request) string {
+	query := r.URL.Query()
+	candidates := strings.Split(query.Get("myip"), ",")
+	candidates = append(candidates, query.Get("myipv6"))
+	if query.Get("myip") == "" {
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			candidates = append(candidates, host)
+		}
+	}
+
+	ipv6 := strings.ToUpper(s.Configuration.IPType) == godns.IPV6
+	for _, candidate := range candidates {
+		ip := net.ParseIP(strings.TrimSpace(candidate))
+		if ip == nil {
+			continue
+		}
+		if (ip.To4() == nil) == ipv6 {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// findDomain returns the configured domain owning hostname, and the
+// subdomain part of hostname, which is @ for the domain itself
+func (s *Server) findDomain(hostname string) (*godns.Domain, string) {
+	var owner *godns.Domain
+	for i := range s.Configuration.Domains {
+		domain := &s.Configuration.Domains[i]
+		name := strings.ToLower(domain.DomainName)
+		if hostname == name {
+			return domain, "@"
+		}
+		if !strings.HasSuffix(hostname, "."+name) {
+			continue
+		}
+		// the most specific domain wins
+		if owner == nil || len(domain.DomainName) > len(owner.DomainName) {
+			owner = domain
+		}
+	}
+
+	if owner == nil {
+		return nil, ""
+	}
+	return owner, strings.TrimSuffix(hostname, "."+strings.ToLower(owner.DomainName))
+}
+
+// Allowed reports whether client may update hostname. Hostnames are
+// matched exactly, or with a leading "*." matching any subdomain.
+func Allowed(client *godns.DynDNS2Client, hostname string) bool {
+	for _, allowed := range client.Hostnames {
+		allowed = strings.ToLower(strings.TrimSuffix(allowed, "."))
+		if allowed == hostname {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(hostname, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
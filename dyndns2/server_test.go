@@ -0,0 +1,114 @@
+package dyndns2
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jmbayu/godns"
+)
+
+type fakeSetter struct {
+	records map[string]string
+	err     error
+}
+
+func (f *fakeSetter) SetRecord(domain, subDomain, ip string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.records[subDomain+"."+domain] = ip
+	return nil
+}
+
+func newTestServer() (*httptest.Server, *fakeSetter) {
+	setter := &fakeSetter{records: map[string]string{}}
+	s := NewServer(&godns.Settings{
+		IPType:  godns.IPV4,
+		Domains: []godns.Domain{{DomainName: "example.com"}},
+		DynDNS2Server: godns.DynDNS2ServerSettings{
+			Clients: []godns.DynDNS2Client{
+				{Username: "router", Password: "secret", Hostnames: []string{"*.home.example.com", "nas.example.com", "example.com"}},
+			},
+		},
+	}, setter)
+
+	return httptest.NewServer(s.Handler()), setter
+}
+
+func request(t *testing.T, url, username, password string) (int, string) {
+	req, _ := http.NewRequest("GET", url, nil)
+	req.SetBasicAuth(username, password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(body))
+}
+
+func TestServeUpdate(t *testing.T) {
+	ts, setter := newTestServer()
+	defer ts.Close()
+
+	status, body := request(t, ts.URL+"/nic/update?hostname=nas.example.com&myip=192.0.2.1", "router", "secret")
+	if status != http.StatusOK || body != "good 192.0.2.1" {
+		t.Errorf("first update should be good, got %d %q", status, body)
+	}
+	if setter.records["nas.example.com"] != "192.0.2.1" {
+		t.Errorf("nas.example.com should be set to 192.0.2.1, got %v", setter.records)
+	}
+
+	_, body = request(t, ts.URL+"/nic/update?hostname=nas.example.com&myip=192.0.2.1", "router", "secret")
+	if body != "nochg 192.0.2.1" {
+		t.Errorf("repeated update should be nochg, got %q", body)
+	}
+
+	_, body = request(t, ts.URL+"/nic/update?hostname=pi.home.example.com,www.example.com&myip=192.0.2.2", "router", "secret")
+	if body != "good 192.0.2.2\nnohost" {
+		t.Errorf("wildcard host should be updated and foreign host refused, got %q", body)
+	}
+
+	_, body = request(t, ts.URL+"/nic/update?hostname=example.com&myip=192.0.2.4", "router", "secret")
+	if body != "good 192.0.2.4" || setter.records["@.example.com"] != "192.0.2.4" {
+		t.Errorf("the domain itself should update its apex, got %q %v", body, setter.records)
+	}
+
+	_, body = request(t, ts.URL+"/nic/update?hostname=nas.example.com&myip=2001:db8::1", "router", "secret")
+	if body != "dnserr" {
+		t.Errorf("address of the wrong family should be refused, got %q", body)
+	}
+
+	setter.err = errors.New("provider is down")
+	_, body = request(t, ts.URL+"/nic/update?hostname=tv.home.example.com&myip=192.0.2.3", "router", "secret")
+	if body != "dnserr" {
+		t.Errorf("provider failure should be reported as dnserr, got %q", body)
+	}
+}
+
+func TestServeBadAuth(t *testing.T) {
+	ts, setter := newTestServer()
+	defer ts.Close()
+
+	status, body := request(t, ts.URL+"/nic/update?hostname=nas.example.com&myip=192.0.2.1", "router", "wrong")
+	if status != http.StatusUnauthorized || body != "badauth" {
+		t.Errorf("wrong password should be badauth, got %d %q", status, body)
+	}
+	if len(setter.records) != 0 {
+		t.Errorf("no record should be set, got %v", setter.records)
+	}
+}
+
+func TestServeRoutes(t *testing.T) {
+	ts, _ := newTestServer()
+	defer ts.Close()
+
+	if status, _ := request(t, ts.URL+"/?hostname=nas.example.com&myip=192.0.2.1", "router", "secret"); status != http.StatusNotFound {
+		t.Errorf("only /nic/update should be served, got %d", status)
+	}
+}
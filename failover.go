@@ -0,0 +1,122 @@
+package godns
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHoldDown is how long a preferred IP source has to stay healthy,
+// by default, before the failover switches back to it
+const DefaultHoldDown = 300 * time.Second
+
+// failover keeps the IP source a failover domain is following
+type failover struct {
+	active string
+	// healthySince is when each source was last found healthy after
+	// being unhealthy
+	healthySince map[string]time.Time
+}
+
+var (
+	failovers   = map[string]*failover{}
+	failoversMu sync.Mutex
+)
+
+// failoverKey tells the failover domains apart, the same domain name may
+// be listed several times
+func failoverKey(domain *Domain) string {
+	return domain.DomainName + "/" + strings.Join(domain.SubDomains, ",")
+}
+
+// getFailoverIP checks the IP sources of the failover of domain, and
+// returns the IP of the one it follows. A switch is logged and notified.
+func getFailoverIP(configuration *Settings, domain *Domain) (string, error) {
+	ips := map[string]string{}
+	healthy := map[string]bool{}
+	for _, name := range domain.Failover.IPSources {
+		ip, err := CheckIPSource(configuration, name)
+		if err != nil {
+			Warnf("Uplink %s of %s is unhealthy: %s", name, domain.DomainName, err)
+			continue
+		}
+		ips[name] = ip
+		healthy[name] = true
+	}
+
+	holdDown := DefaultHoldDown
+	if domain.Failover.HoldDown > 0 {
+		holdDown = time.Duration(domain.Failover.HoldDown) * time.Second
+	}
+
+	failoversMu.Lock()
+	f, ok := failovers[failoverKey(domain)]
+	if !ok {
+		f = &failover{healthySince: map[string]time.Time{}}
+		failovers[failoverKey(domain)] = f
+	}
+	previous := f.active
+	active := f.choose(domain.Failover.IPSources, healthy, time.Now(), holdDown)
+	failoversMu.Unlock()
+
+	if active == "" {
+		return "", errors.New("no healthy uplink for " + domain.DomainName)
+	}
+	if previous != "" && previous != active {
+		recovery := priority(domain.Failover.IPSources, active) < priority(domain.Failover.IPSources, previous)
+		event := "Failover"
+		if recovery {
+			event = "Recovery"
+		}
+		Warnf("%s of %s from uplink %s to %s (%s)", event, domain.DomainName, previous, active, ips[active])
+		if err := SendFailoverNotify(configuration, domain.DomainName, ips[active], previous, active, recovery); err != nil {
+			Error("Failed to send failover notification")
+		}
+	}
+	return ips[active], nil
+}
+
+// choose returns the source to follow: the active one while it is
+// healthy, unless a preferred one has been healthy for holdDown, else the
+// first healthy one. It is empty when none is healthy.
+func (f *failover) choose(order []string, healthy map[string]bool, now time.Time, holdDown time.Duration) string {
+	for _, name := range order {
+		if !healthy[name] {
+			delete(f.healthySince, name)
+		} else if _, ok := f.healthySince[name]; !ok {
+			f.healthySince[name] = now
+		}
+	}
+
+	activeHealthy := f.active != "" && healthy[f.active]
+	for _, name := range order {
+		if !healthy[name] {
+			continue
+		}
+		if name == f.active {
+			break
+		}
+		if activeHealthy && now.Sub(f.healthySince[name]) < holdDown {
+			continue
+		}
+		f.active = name
+		return name
+	}
+
+	// the active source is kept while none is healthy, to notify of the
+	// switch once one is
+	if !activeHealthy {
+		return ""
+	}
+	return f.active
+}
+
+func priority(order []string, name string) int {
+	for i, n := range order {
+		if n == name {
+			return i
+		}
+	}
+	return len(order)
+}
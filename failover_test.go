@@ -0,0 +1,77 @@
+package godns
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFailoverChoose(t *testing.T) {
+	order := []string{"wan1", "wan2"}
+	f := &failover{healthySince: map[string]time.Time{}}
+	start := time.Now()
+	holdDown := time.Minute
+
+	steps := []struct {
+		after    time.Duration
+		healthy  []string
+		expected string
+	}{
+		{0, []string{"wan1", "wan2"}, "wan1"},
+		{time.Second, []string{"wan2"}, "wan2"},
+		// wan1 is back, but not for long enough
+		{2 * time.Second, []string{"wan1", "wan2"}, "wan2"},
+		{30 * time.Second, []string{"wan1", "wan2"}, "wan2"},
+		{2*time.Second + time.Minute, []string{"wan1", "wan2"}, "wan1"},
+		{2 * time.Minute, nil, ""},
+		// the failover is immediate when the active source fails
+		{3 * time.Minute, []string{"wan2"}, "wan2"},
+	}
+	for i, step := range steps {
+		healthy := map[string]bool{}
+		for _, name := range step.healthy {
+			healthy[name] = true
+		}
+		if got := f.choose(order, healthy, start.Add(step.after), holdDown); got != step.expected {
+			t.Errorf("step %d: expected %q, got %q", i, step.expected, got)
+		}
+	}
+}
+
+func TestGetDomainIPFailover(t *testing.T) {
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "198.51.100.1")
+	}))
+	defer echo.Close()
+
+	// a closed port, so that the health check of wan1 fails
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := listener.Addr().String()
+	listener.Close()
+
+	settings := &Settings{
+		IPType: IPV4,
+		IPSources: map[string]IPSource{
+			"wan1": {IPUrl: echo.URL, HealthCheck: HealthCheck{Type: HealthTCP, Target: closed, Timeout: 1}},
+			"wan2": {IPUrl: echo.URL, HealthCheck: HealthCheck{Type: HealthHTTP, Target: echo.URL}},
+		},
+	}
+	domain := &Domain{DomainName: "example.com", SubDomains: []string{"failover-test"}, Failover: FailoverSettings{IPSources: []string{"wan1", "wan2"}}}
+	defer delete(failovers, failoverKey(domain))
+
+	if _, err := CheckIPSource(settings, "wan1"); err == nil {
+		t.Error("the health check of wan1 should fail")
+	}
+	if _, err := GetDomainIP(settings, domain); err != nil {
+		t.Fatal(err)
+	}
+	if failovers[failoverKey(domain)].active != "wan2" {
+		t.Errorf("expected wan2 to be active, got %q", failovers[failoverKey(domain)].active)
+	}
+}
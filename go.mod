@@ -1,6 +1,7 @@
 module github.com/jmbayu/godns
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/bitly/go-simplejson v0.5.0
 	github.com/bmizerany/assert v0.0.0-20160611221934-b7ed37b82869 // indirect
 	github.com/bogdanovich/dns_resolver v0.0.0-20170211073258-a8e42bc6a5b6
@@ -8,10 +9,11 @@ require (
 	github.com/google/uuid v1.1.1
 	github.com/influxdata/influxdb-client-go v1.4.0
 	github.com/kr/pretty v0.1.0 // indirect
-	github.com/miekg/dns v1.1.29
+	github.com/miekg/dns v1.1.31
 	golang.org/x/net v0.0.0-20191112182307-2180aed22343
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
+	gopkg.in/yaml.v2 v2.2.5
 )
 
 go 1.13
@@ -22,6 +22,8 @@ import (
 type AliDNS struct {
 	AccessKeyID     string
 	AccessKeySecret string
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
 }
 
 var (
@@ -51,6 +53,14 @@ type domainRecords struct {
 	Record []DomainRecord
 }
 
+type domainsResp struct {
+	Domains struct {
+		Domain []struct {
+			DomainName string
+		}
+	}
+}
+
 // DomainRecord struct
 type DomainRecord struct {
 	DomainName string
@@ -65,11 +75,16 @@ type DomainRecord struct {
 	Locked     bool
 }
 
-func getHTTPBody(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+func (d *AliDNS) getHTTPBody(url string) ([]byte, error) {
+	client := d.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(url)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if resp.StatusCode == http.StatusOK {
 		return body, err
@@ -90,23 +105,69 @@ func NewAliDNS(key, secret string) *AliDNS {
 
 // GetDomainRecords gets all the doamin records according to input subdomain key
 func (d *AliDNS) GetDomainRecords(domain, rr string) []DomainRecord {
+	records, err := d.DescribeSubDomainRecords(domain, rr)
+	if err != nil {
+		logger.Errorf("GetDomainRecords error: %+v", err)
+		return nil
+	}
+	return records
+}
+
+// DescribeSubDomainRecords lists the records of subdomain rr of domain
+func (d *AliDNS) DescribeSubDomainRecords(domain, rr string) ([]DomainRecord, error) {
 	resp := &domainRecordsResp{}
 	parms := map[string]string{
 		"Action":    "DescribeSubDomainRecords",
 		"SubDomain": fmt.Sprintf("%s.%s", rr, domain),
 	}
-	urlPath := d.genRequestURL(parms)
-	body, err := getHTTPBody(urlPath)
+	body, err := d.getHTTPBody(d.genRequestURL(parms))
 	if err != nil {
-		fmt.Printf("GetDomainRecords error.%+v\n", err)
-	} else {
-		if err := json.Unmarshal(body, resp); err != nil {
-			fmt.Printf("GetDomainRecords error. %+v\n", err)
-			return nil
-		}
-		return resp.DomainRecords.Record
+		return nil, err
+	}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+	return resp.DomainRecords.Record, nil
+}
+
+// DescribeDomains lists the domains of the account
+func (d *AliDNS) DescribeDomains() ([]string, error) {
+	resp := &domainsResp{}
+	parms := map[string]string{
+		"Action":   "DescribeDomains",
+		"PageSize": "100",
+	}
+	body, err := d.getHTTPBody(d.genRequestURL(parms))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+
+	var domains []string
+	for _, domain := range resp.Domains.Domain {
+		domains = append(domains, domain.DomainName)
+	}
+	return domains, nil
+}
+
+// DescribeDomainRecords lists the records of domain
+func (d *AliDNS) DescribeDomainRecords(domain string) ([]DomainRecord, error) {
+	resp := &domainRecordsResp{}
+	parms := map[string]string{
+		"Action":     "DescribeDomainRecords",
+		"DomainName": domain,
+		"PageSize":   "500",
+	}
+	body, err := d.getHTTPBody(d.genRequestURL(parms))
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	if err := json.Unmarshal(body, resp); err != nil {
+		return nil, err
+	}
+	return resp.DomainRecords.Record, nil
 }
 
 // UpdateDomainRecord updates domain record
@@ -125,15 +186,41 @@ func (d *AliDNS) UpdateDomainRecord(r DomainRecord) error {
 	if urlPath == "" {
 		return errors.New("failed to generate request URL")
 	}
-	_, err := getHTTPBody(urlPath)
+	_, err := d.getHTTPBody(urlPath)
 	if err != nil {
-		fmt.Printf("UpdateDomainRecord error.%+v\n", err)
+		logger.Errorf("UpdateDomainRecord error: %+v", err)
 	}
 	return err
 }
 
+// AddDomainRecord adds a record of type to subdomain rr of domain
+func (d *AliDNS) AddDomainRecord(domain, rr, recordType, value string) error {
+	parms := map[string]string{
+		"Action":     "AddDomainRecord",
+		"DomainName": domain,
+		"RR":         rr,
+		"Type":       recordType,
+		"Value":      value,
+	}
+
+	urlPath := d.genRequestURL(parms)
+	if urlPath == "" {
+		return errors.New("failed to generate request URL")
+	}
+	_, err := d.getHTTPBody(urlPath)
+	return err
+}
+
+// percentEncode encodes s as the signature requires, RFC 3986 with spaces
+// as %20
+func percentEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.Replace(s, "+", "%20", -1)
+	s = strings.Replace(s, "*", "%2A", -1)
+	return strings.Replace(s, "%7E", "~", -1)
+}
+
 func (d *AliDNS) genRequestURL(parms map[string]string) string {
-	var pArr []string
 	ps := map[string]string{}
 	for k, v := range publicParm {
 		ps[k] = v
@@ -146,21 +233,32 @@ func (d *AliDNS) genRequestURL(parms map[string]string) string {
 	ps["SignatureNonce"] = strconv.Itoa(int(now.UnixNano()) + rand.Intn(99999))
 	ps["Timestamp"] = now.Format("2006-01-02T15:04:05Z")
 
-	for k, v := range ps {
-		pArr = append(pArr, fmt.Sprintf("%s=%s", k, v))
+	path, sign, err := signQuery(d.AccessKeySecret, ps)
+	if err != nil {
+		return ""
 	}
-	sort.Strings(pArr)
-	path := strings.Join(pArr, "&")
+	return fmt.Sprintf("%s?%s&Signature=%s", baseURL, path, percentEncode(sign))
+}
 
-	s := "GET&%2F&" + url.QueryEscape(path)
-	s = strings.Replace(s, "%3A", "%253A", -1)
-	s = strings.Replace(s, "%40", "%2540", -1)
-	s = strings.Replace(s, "%2A", "%252A", -1)
-	mac := hmac.New(sha1.New, []byte(d.AccessKeySecret+"&"))
+// signQuery returns the canonicalized query of ps, sorted by name, and its
+// HMAC-SHA1 signature with secret
+func signQuery(secret string, ps map[string]string) (string, string, error) {
+	var keys []string
+	for k := range ps {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
+	var pArr []string
+	for _, k := range keys {
+		pArr = append(pArr, percentEncode(k)+"="+percentEncode(ps[k]))
+	}
+	path := strings.Join(pArr, "&")
+
+	s := "GET&%2F&" + percentEncode(path)
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
 	if _, err := mac.Write([]byte(s)); err != nil {
-		return ""
+		return "", "", err
 	}
-	sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
-	return fmt.Sprintf("%s?%s&Signature=%s", baseURL, path, url.QueryEscape(sign))
+	return path, base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
 }
@@ -1,14 +1,47 @@
 package alidns
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/jmbayu/godns"
 )
 
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.ALIDNS)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.ALIDNS,
+		Description:  "AliDNS",
+		URL:          "https://help.aliyun.com/product/29697.html",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "alidns",
+		Credentials:  godns.AliDNSSettings{},
+		Validate:     validate,
+		Migrate:      migrate,
+		Capabilities: godns.Capabilities{Ownership: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.AliDNS.AccessKeyID == "" {
+		return errors.New("alidns access key id cannot be empty")
+	}
+	if config.AliDNS.AccessKeySecret == "" {
+		return errors.New("alidns access key secret cannot be empty")
+	}
+	return nil
+}
+
+func migrate(config *godns.Settings) {
+	godns.MigrateCredential(config, &config.Email, "email", &config.AliDNS.AccessKeyID, "alidns.access_key_id")
+	godns.MigrateCredential(config, &config.Password, "password", &config.AliDNS.AccessKeySecret, "alidns.access_key_secret")
+}
+
 // Handler struct
 type Handler struct {
 	Configuration *godns.Settings
@@ -19,67 +52,212 @@ func (handler *Handler) SetConfiguration(conf *godns.Settings) {
 	handler.Configuration = conf
 }
 
+// aliDNS returns the AliDNS client of the configuration, sending its
+// requests with the shared HTTP client
+func (handler *Handler) aliDNS() *AliDNS {
+	aliDNS := *NewAliDNS(handler.Configuration.AliDNS.AccessKeyID, handler.Configuration.AliDNS.AccessKeySecret)
+	aliDNS.HTTPClient = godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
+	return &aliDNS
+}
+
 // DomainLoop the main logic loop
 func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
 	defer func() {
 		if err := recover(); err != nil {
-			log.Printf("Recovered in %v: %v\n", err, debug.Stack())
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
 			panicChan <- *domain
 		}
 	}()
 
 	looping := false
-	aliDNS := NewAliDNS(handler.Configuration.Email, handler.Configuration.Password)
+	aliDNS := handler.aliDNS()
 
 	for {
 		if looping {
 			// Sleep with interval
-			log.Printf("Going to sleep, will start next checking in %d seconds...\r\n", handler.Configuration.Interval)
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
 			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
 		}
 
 		looping = true
-		currentIP, err := godns.GetCurrentIP(handler.Configuration)
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
 
 		if err != nil {
-			log.Println("Failed to get current IP:", err)
+			logger.Error("Failed to get current IP:", err)
 			continue
 		}
-		log.Println("currentIP is:", currentIP)
+		logger.Info("currentIP is:", currentIP)
 		for _, subDomain := range domain.SubDomains {
 			hostname := subDomain + "." + domain.DomainName
-			lastIP, err := godns.ResolveDNS(hostname, handler.Configuration.Resolver, handler.Configuration.IPType)
-			if err != nil {
-				log.Println(err)
+
+			// the records are read at most once, they are needed for the update anyway
+			var records []DomainRecord
+			fetched := false
+			getRecords := func() []DomainRecord {
+				if !fetched {
+					fetched = true
+					records = aliDNS.GetDomainRecords(domain.DomainName, subDomain)
+				}
+				return records
+			}
+			providerValue := func() (string, error) {
+				if record, ok := handler.addressRecord(getRecords()); ok {
+					return record.Value, nil
+				}
+				return "", fmt.Errorf("cannot get subdomain %s from AliDNS", subDomain)
+			}
+
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, providerValue, godns.CompareDNS) {
 				continue
 			}
-			//check against currently known IP, if no change, skip update
-			if currentIP == lastIP {
-				log.Printf("IP is the same as cached one. Skip update.\n")
-			} else {
-				lastIP = currentIP
 
-				log.Printf("%s.%s Start to update record IP...\n", subDomain, domain.DomainName)
-				records := aliDNS.GetDomainRecords(domain.DomainName, subDomain)
-				if records == nil || len(records) == 0 {
-					log.Printf("Cannot get subdomain %s from AliDNS.\r\n", subDomain)
-					continue
-				}
+			logger.Infof("%s.%s Start to update record IP...", subDomain, domain.DomainName)
+			record, ok := handler.addressRecord(getRecords())
+			if !ok {
+				logger.Errorf("Cannot get subdomain %s from AliDNS.", subDomain)
+				continue
+			}
+			if err := handler.claim(aliDNS, domain.DomainName, subDomain); err != nil {
+				logger.Warn("Skipping record:", err)
+				continue
+			}
 
-				records[0].Value = currentIP
-				if err := aliDNS.UpdateDomainRecord(records[0]); err != nil {
-					log.Printf("Failed to update IP for subdomain:%s\r\n", subDomain)
-					continue
-				} else {
-					log.Printf("IP updated for subdomain:%s\r\n", subDomain)
-				}
+			record.Value = currentIP
+			if err := aliDNS.UpdateDomainRecord(record); err != nil {
+				logger.Errorf("Failed to update IP for subdomain:%s", subDomain)
+				continue
+			} else {
+				logger.Infof("IP updated for subdomain:%s", subDomain)
+			}
 
-				// Send notification
-				if err := godns.SendNotify(handler.Configuration, fmt.Sprintf("%s.%s", subDomain, domain.DomainName), currentIP); err != nil {
-					log.Printf("Failed to send notification")
-				}
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Errorf("Failed to send notification")
 			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, readBack(aliDNS, domain.DomainName, subDomain, record.RecordID))
+		}
+	}
+
+}
+
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	aliDNS := handler.aliDNS()
+
+	record, ok := handler.addressRecord(aliDNS.GetDomainRecords(domain, subDomain))
+	if !ok {
+		return fmt.Errorf("cannot get subdomain %s from AliDNS", subDomain)
+	}
+	if err := handler.claim(aliDNS, domain, subDomain); err != nil {
+		return err
+	}
+
+	record.Value = ip
+	return aliDNS.UpdateDomainRecord(record)
+}
+
+// CheckAuth lists the domains of the account
+func (handler *Handler) CheckAuth() error {
+	_, err := handler.aliDNS().DescribeDomains()
+	return err
+}
+
+// ListZones lists the domains of the account
+func (handler *Handler) ListZones() ([]string, error) {
+	return handler.aliDNS().DescribeDomains()
+}
+
+// ListRecords lists the records of zone, of all types
+func (handler *Handler) ListRecords(zone string) ([]godns.Record, error) {
+	aliDNS := handler.aliDNS()
+	list, err := aliDNS.DescribeDomainRecords(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []godns.Record
+	for _, record := range list {
+		name := record.RR + "." + zone
+		if record.RR == "@" {
+			name = zone
+		}
+		records = append(records, godns.Record{Name: name, Type: record.Type, Value: record.Value, TTL: record.TTL})
+	}
+	return records, nil
+}
+
+// CheckRecord checks that domain has the record of subDomain
+func (handler *Handler) CheckRecord(domain, subDomain string) error {
+	aliDNS := handler.aliDNS()
+	records, err := aliDNS.DescribeSubDomainRecords(domain, subDomain)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := handler.addressRecord(records); ok {
+		return nil
+	}
+	return fmt.Errorf("no %s record %s.%s", handler.recordType(), subDomain, domain)
+}
+
+// addressRecord returns the first record of the type of ip_type, the
+// others are left alone
+func (handler *Handler) addressRecord(records []DomainRecord) (DomainRecord, bool) {
+	for _, record := range records {
+		if record.Type == handler.recordType() {
+			return record, true
 		}
 	}
+	return DomainRecord{}, false
+}
+
+// claim checks the ownership of the record of subDomain in its companion
+// TXT record, and adds the marker of this instance to an adopted record
+func (handler *Handler) claim(aliDNS *AliDNS, domain, subDomain string) error {
+	if !handler.Configuration.Ownership.Enabled {
+		return nil
+	}
+
+	records, err := aliDNS.DescribeSubDomainRecords(domain, godns.OwnershipName(subDomain))
+	if err != nil {
+		return err
+	}
+	var markers []string
+	for _, record := range records {
+		if record.Type == "TXT" {
+			markers = append(markers, record.Value)
+		}
+	}
+
+	hostname := subDomain + "." + domain
+	text := strings.Join(markers, " ")
+	if err := godns.CheckOwner(handler.Configuration, hostname, text); err != nil {
+		return err
+	}
+	if !strings.Contains(text, godns.OwnerMarker(handler.Configuration)) {
+		logger.Infof("Adopting %s, marking it as owned", hostname)
+		return aliDNS.AddDomainRecord(domain, godns.OwnershipName(subDomain), "TXT", godns.OwnerMarker(handler.Configuration))
+	}
+	return nil
+}
 
+func (handler *Handler) recordType() string {
+	if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// readBack reads the value of an updated record back from AliDNS
+func readBack(aliDNS *AliDNS, domain, subDomain, recordID string) godns.ReadBackFunc {
+	return func() (string, error) {
+		for _, record := range aliDNS.GetDomainRecords(domain, subDomain) {
+			if record.RecordID == recordID {
+				return record.Value, nil
+			}
+		}
+		return "", fmt.Errorf("cannot get record %s from AliDNS", recordID)
+	}
 }
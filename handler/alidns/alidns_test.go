@@ -0,0 +1,48 @@
+package alidns
+
+import "testing"
+
+// TestSignQuery checks the signature against the example of the Alibaba
+// Cloud documentation of the RPC API signature
+func TestSignQuery(t *testing.T) {
+	ps := map[string]string{
+		"AccessKeyId":      "testid",
+		"Action":           "DescribeRegions",
+		"Format":           "XML",
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureNonce":   "3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf",
+		"SignatureVersion": "1.0",
+		"Timestamp":        "2016-02-23T12:46:24Z",
+		"Version":          "2014-05-26",
+	}
+
+	path, sign, err := signQuery("testsecret", ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPath := "AccessKeyId=testid&Action=DescribeRegions&Format=XML&SignatureMethod=HMAC-SHA1" +
+		"&SignatureNonce=3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf&SignatureVersion=1.0" +
+		"&Timestamp=2016-02-23T12%3A46%3A24Z&Version=2014-05-26"
+	if path != wantPath {
+		t.Errorf("the query should be\n%s\ngot\n%s", wantPath, path)
+	}
+	if sign != "OLeaidS1JvxuMvnyHOwuJ+uX5qY=" {
+		t.Errorf("the signature should be OLeaidS1JvxuMvnyHOwuJ+uX5qY=, got %s", sign)
+	}
+}
+
+func TestPercentEncode(t *testing.T) {
+	tests := map[string]string{
+		"abcXYZ019-_.~":                      "abcXYZ019-_.~",
+		"a b":                                "a%20b",
+		"a*b":                                "a%2Ab",
+		"a+b":                                "a%2Bb",
+		"heritage=godns,godns/owner=default": "heritage%3Dgodns%2Cgodns%2Fowner%3Ddefault",
+		"中":                                  "%E4%B8%AD",
+	}
+	for s, want := range tests {
+		if got := percentEncode(s); got != want {
+			t.Errorf("%q should be encoded as %s, got %s", s, want, got)
+		}
+	}
+}
@@ -3,11 +3,12 @@ package cloudflare
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"net/url"
 	"runtime/debug"
 	"strings"
 	"time"
@@ -15,6 +16,42 @@ import (
 	"github.com/jmbayu/godns"
 )
 
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.CLOUDFLARE)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.CLOUDFLARE,
+		Description:  "Cloudflare",
+		URL:          "https://cloudflare.com",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "cloudflare",
+		Credentials:  godns.CloudflareSettings{},
+		Validate:     validate,
+		Migrate:      migrate,
+		Capabilities: godns.Capabilities{IPv6: true, Membership: true, Ownership: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	conf := config.Cloudflare
+	if conf.APIToken == "" {
+		if conf.Email == "" {
+			return errors.New("cloudflare email cannot be empty")
+		}
+		if conf.APIKey == "" {
+			return errors.New("cloudflare api key cannot be empty")
+		}
+	}
+	return nil
+}
+
+func migrate(config *godns.Settings) {
+	godns.MigrateCredential(config, &config.LoginToken, "login_token", &config.Cloudflare.APIToken, "cloudflare.api_token")
+	godns.MigrateCredential(config, &config.Email, "email", &config.Cloudflare.Email, "cloudflare.email")
+	godns.MigrateCredential(config, &config.Password, "password", &config.Cloudflare.APIKey, "cloudflare.api_key")
+}
+
 // Handler struct definition
 type Handler struct {
 	Configuration *godns.Settings
@@ -42,6 +79,7 @@ type DNSRecord struct {
 	Type    string `json:"type"`
 	ZoneID  string `json:"zone_id"`
 	TTL     int32  `json:"ttl"`
+	Comment string `json:"comment,omitempty"`
 }
 
 // SetIP updates DNSRecord.IP
@@ -69,59 +107,105 @@ func (handler *Handler) SetConfiguration(conf *godns.Settings) {
 
 // DomainLoop the main logic loop
 func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
 	defer func() {
 		if err := recover(); err != nil {
-			log.Printf("Recovered in %v: %v\n", err, debug.Stack())
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
 			panicChan <- *domain
 		}
 	}()
 
-	var lastIP string
 	looping := false
 	for {
 		if looping {
 			// Sleep with interval
-			log.Printf("Going to sleep, will start next checking in %d seconds...\r\n", handler.Configuration.Interval)
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
 			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
 		}
 		looping = true
 
-		currentIP, err := godns.GetCurrentIP(handler.Configuration)
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
 		if err != nil {
-			log.Println("Error in GetCurrentIP:", err)
+			logger.Error("Error in GetCurrentIP:", err)
 			continue
 		}
-		log.Println("Current IP is:", currentIP)
-		//check against locally cached IP, if no change, skip update
-		if currentIP == lastIP {
-			log.Printf("IP is the same as cached one. Skip update.\n")
-		} else {
-			log.Println("Checking IP for domain", domain.DomainName)
-			zoneID := handler.getZone(domain.DomainName)
-			if zoneID != "" {
-				records := handler.getDNSRecords(zoneID)
-
-				// update records
-				for _, rec := range records {
-					if !recordTracked(domain, &rec) {
-						log.Println("Skiping record:", rec.Name)
-						continue
-					}
-					if rec.IP != currentIP {
-						log.Printf("IP mismatch: Current(%+v) vs Cloudflare(%+v)\r\n", currentIP, rec.IP)
-						lastIP = handler.updateRecord(rec, currentIP)
-
-						// Send notification
-						if err := godns.SendNotify(handler.Configuration, rec.Name, currentIP); err != nil {
-							log.Println("Failed to send notification")
-						}
-					} else {
-						log.Printf("Record OK: %+v - %+v\r\n", rec.Name, rec.IP)
+		logger.Info("Current IP is:", currentIP)
+		logger.Info("Checking IP for domain", domain.DomainName)
+
+		// records are only fetched once per loop, and only when needed
+		var records []DNSRecord
+		fetched := false
+		fetchRecords := func() []DNSRecord {
+			if !fetched {
+				fetched = true
+				if zoneID := handler.getZone(domain.DomainName); zoneID != "" {
+					records = handler.getDNSRecords(zoneID)
+				} else {
+					logger.Error("Failed to find zone for domain:", domain.DomainName)
+				}
+			}
+			return records
+		}
+
+		stale := map[string]bool{}
+		for _, subDomain := range domain.SubDomains {
+			if domain.IsMember(subDomain) {
+				if err := godns.UpdateMember(handler.Configuration, handler, domain, subDomain, currentIP); err != nil {
+					logger.Error("Failed to update the membership of", subDomain+":", err)
+				}
+				continue
+			}
+
+			hostname := fmt.Sprintf("%s.%s", subDomain, domain.DomainName)
+			providerValue := func() (string, error) {
+				for _, rec := range fetchRecords() {
+					if rec.Name == hostname {
+						return rec.IP, nil
 					}
 				}
-			} else {
-				log.Println("Failed to find zone for domain:", domain.DomainName)
+				return "", fmt.Errorf("record %s not found", hostname)
 			}
+
+			if godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, providerValue,
+				godns.CompareLocalState, godns.CompareProviderAPI) {
+				stale[hostname] = true
+			}
+		}
+
+		if len(stale) == 0 {
+			continue
+		}
+
+		// update records
+		for _, rec := range fetchRecords() {
+			if !recordTracked(domain, &rec) {
+				logger.Debug("Skiping record:", rec.Name)
+				continue
+			}
+			if !stale[rec.Name] {
+				continue
+			}
+			if rec.IP == currentIP {
+				logger.Infof("Record OK: %+v - %+v", rec.Name, rec.IP)
+				godns.GetStateStore(handler.Configuration).SetIP(rec.Name, currentIP)
+				continue
+			}
+
+			logger.Warnf("IP mismatch: Current(%+v) vs Cloudflare(%+v)", currentIP, rec.IP)
+			if err := godns.CheckOwner(handler.Configuration, rec.Name, rec.Comment); err != nil {
+				logger.Warn("Skipping record:", err)
+				continue
+			}
+			if handler.updateRecord(rec, currentIP) == "" {
+				continue
+			}
+
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, rec.Name, currentIP); err != nil {
+				logger.Error("Failed to send notification")
+			}
+
+			godns.RecordUpdated(handler.Configuration, rec.Name, currentIP, handler.readBack(rec))
 		}
 	}
 }
@@ -138,21 +222,239 @@ func recordTracked(domain *godns.Domain, record *DNSRecord) bool {
 	return false
 }
 
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	zoneID := handler.getZone(domain)
+	if zoneID == "" {
+		return fmt.Errorf("failed to find zone for domain: %s", domain)
+	}
+
+	hostname := fmt.Sprintf("%s.%s", subDomain, domain)
+	found := false
+	for _, rec := range handler.getDNSRecords(zoneID) {
+		if rec.Name != hostname {
+			continue
+		}
+		found = true
+		if rec.IP == ip {
+			continue
+		}
+		if err := godns.CheckOwner(handler.Configuration, rec.Name, rec.Comment); err != nil {
+			return err
+		}
+		if handler.updateRecord(rec, ip) == "" {
+			return fmt.Errorf("failed to update record %s", hostname)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("record %s not found", hostname)
+	}
+	return nil
+}
+
+// ListMembers returns the addresses of the records of subDomain
+func (handler *Handler) ListMembers(domain, subDomain string) ([]string, error) {
+	records, err := handler.memberRecords(domain, subDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []string
+	for _, rec := range records {
+		members = append(members, rec.IP)
+	}
+	return members, nil
+}
+
+// AddMember creates a record of subDomain with ip, besides the others
+func (handler *Handler) AddMember(domain, subDomain, ip string) error {
+	zoneID := handler.getZone(domain)
+	if zoneID == "" {
+		return fmt.Errorf("zone %s not found", domain)
+	}
+
+	// a TTL of 1 is automatic
+	record := map[string]interface{}{
+		"type":    handler.recordType(),
+		"name":    fmt.Sprintf("%s.%s", subDomain, domain),
+		"content": ip,
+		"ttl":     1,
+		"proxied": false,
+	}
+	if handler.Configuration.Ownership.Enabled {
+		record["comment"] = godns.OwnerMarker(handler.Configuration)
+	}
+	j, _ := json.Marshal(record)
+	var r DNSRecordUpdateResponse
+	return handler.send("POST", "/zones/"+zoneID+"/dns_records", bytes.NewBuffer(j), &r)
+}
+
+// RemoveMember deletes the record of subDomain with ip, leaving the others
+func (handler *Handler) RemoveMember(domain, subDomain, ip string) error {
+	records, err := handler.memberRecords(domain, subDomain)
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range records {
+		if rec.IP == ip {
+			if err := godns.CheckOwner(handler.Configuration, rec.Name, rec.Comment); err != nil {
+				return err
+			}
+			var r DNSRecordUpdateResponse
+			return handler.send("DELETE", "/zones/"+rec.ZoneID+"/dns_records/"+rec.ID, nil, &r)
+		}
+	}
+	return nil
+}
+
+// memberRecords lists the records of subDomain, of the type of ip_type
+func (handler *Handler) memberRecords(domain, subDomain string) ([]DNSRecord, error) {
+	zoneID := handler.getZone(domain)
+	if zoneID == "" {
+		return nil, fmt.Errorf("zone %s not found", domain)
+	}
+
+	hostname := fmt.Sprintf("%s.%s", subDomain, domain)
+	var r DNSRecordResponse
+	if err := handler.get(fmt.Sprintf("/zones/%s/dns_records?type=%s&name=%s&per_page=100", zoneID, handler.recordType(), url.QueryEscape(hostname)), &r); err != nil {
+		return nil, err
+	}
+	for i := range r.Records {
+		// the zone_id of the records is deprecated by the API
+		r.Records[i].ZoneID = zoneID
+	}
+	return r.Records, nil
+}
+
+// CheckAuth verifies the API token, or the email and API key
+func (handler *Handler) CheckAuth() error {
+	conf := handler.Configuration.Cloudflare
+	path := "/user"
+	if conf.Email == "" || conf.APIKey == "" {
+		path = "/user/tokens/verify"
+	}
+
+	req, client := handler.newRequest("GET", path, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &r); err != nil {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, godns.Redact(string(body)))
+	}
+	if !r.Success {
+		if len(r.Errors) > 0 {
+			return errors.New(r.Errors[0].Message)
+		}
+		return fmt.Errorf("status %d: %s", resp.StatusCode, godns.Redact(string(body)))
+	}
+	return nil
+}
+
+// CheckRecord checks that the zone of domain has the record of subDomain
+func (handler *Handler) CheckRecord(domain, subDomain string) error {
+	zoneID := handler.getZone(domain)
+	if zoneID == "" {
+		return fmt.Errorf("zone %s not found", domain)
+	}
+
+	hostname := fmt.Sprintf("%s.%s", subDomain, domain)
+	for _, rec := range handler.getDNSRecords(zoneID) {
+		if rec.Name == hostname {
+			return nil
+		}
+	}
+	return fmt.Errorf("no %s record %s", handler.recordType(), hostname)
+}
+
+// ListZones lists the zones of the account
+func (handler *Handler) ListZones() ([]string, error) {
+	var z ZoneResponse
+	if err := handler.get("/zones?per_page=50", &z); err != nil {
+		return nil, err
+	}
+
+	var zones []string
+	for _, zone := range z.Zones {
+		zones = append(zones, zone.Name)
+	}
+	return zones, nil
+}
+
+// ListRecords lists the records of zone, of all types
+func (handler *Handler) ListRecords(zone string) ([]godns.Record, error) {
+	zoneID := handler.getZone(zone)
+	if zoneID == "" {
+		return nil, fmt.Errorf("zone %s not found", zone)
+	}
+
+	var r DNSRecordResponse
+	if err := handler.get("/zones/"+zoneID+"/dns_records?page=1&per_page=500", &r); err != nil {
+		return nil, err
+	}
+
+	var records []godns.Record
+	for _, rec := range r.Records {
+		records = append(records, godns.Record{Name: rec.Name, Type: rec.Type, Value: rec.IP, TTL: int(rec.TTL)})
+	}
+	return records, nil
+}
+
+// get decodes the response of a GET request to the API into result, which
+// must have a Success field
+func (handler *Handler) get(url string, result interface{}) error {
+	return handler.send("GET", url, nil, result)
+}
+
+// send decodes the response of a request to the API into result, which
+// must have a Success field
+func (handler *Handler) send(method, url string, body io.Reader, result interface{}) error {
+	req, client := handler.newRequest(method, url, body)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(content, result); err != nil {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, godns.Redact(string(content)))
+	}
+
+	var status struct {
+		Success bool `json:"success"`
+	}
+	json.Unmarshal(content, &status)
+	if !status.Success {
+		return fmt.Errorf("response failed: %s", godns.Redact(string(content)))
+	}
+	return nil
+}
+
 // Create a new request with auth in place and optional proxy
 func (handler *Handler) newRequest(method, url string, body io.Reader) (*http.Request, *http.Client) {
 	client := godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
-	if client == nil {
-		log.Println("cannot create HTTP client")
-	}
 
 	req, _ := http.NewRequest(method, handler.API+url, body)
 	req.Header.Set("Content-Type", "application/json")
 
-	if handler.Configuration.Email != "" && handler.Configuration.Password != "" {
-		req.Header.Set("X-Auth-Email", handler.Configuration.Email)
-		req.Header.Set("X-Auth-Key", handler.Configuration.Password)
-	} else if handler.Configuration.LoginToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", handler.Configuration.LoginToken))
+	conf := handler.Configuration.Cloudflare
+	if conf.Email != "" && conf.APIKey != "" {
+		req.Header.Set("X-Auth-Email", conf.Email)
+		req.Header.Set("X-Auth-Key", conf.APIKey)
+	} else if conf.APIToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", conf.APIToken))
 	}
 
 	return req, client
@@ -166,19 +468,19 @@ func (handler *Handler) getZone(domain string) string {
 	req, client := handler.newRequest("GET", fmt.Sprintf("/zones?name=%s", domain), nil)
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Request error:", err.Error())
+		logger.Error("Request error:", err.Error())
 		return ""
 	}
 
 	body, _ := ioutil.ReadAll(resp.Body)
 	err = json.Unmarshal(body, &z)
 	if err != nil {
-		log.Printf("Decoder error: %+v\n", err)
-		log.Printf("Response body: %+v\n", string(body))
+		logger.Errorf("Decoder error: %+v", err)
+		logger.Debugf("Response body: %+v", string(body))
 		return ""
 	}
 	if z.Success != true {
-		log.Printf("Response failed: %+v\n", string(body))
+		logger.Errorf("Response failed: %+v", string(body))
 		return ""
 	}
 
@@ -195,32 +497,26 @@ func (handler *Handler) getDNSRecords(zoneID string) []DNSRecord {
 
 	var empty []DNSRecord
 	var r DNSRecordResponse
-	var recordType string
-
-	if handler.Configuration.IPType == "" || strings.ToUpper(handler.Configuration.IPType) == godns.IPV4 {
-		recordType = "A"
-	} else if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
-		recordType = "AAAA"
-	}
+	recordType := handler.recordType()
 
-	log.Println("Querying records with type:", recordType)
+	logger.Debug("Querying records with type:", recordType)
 	req, client := handler.newRequest("GET", fmt.Sprintf("/zones/"+zoneID+"/dns_records?type=%s&page=1&per_page=500", recordType), nil)
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Request error:", err.Error())
+		logger.Error("Request error:", err.Error())
 		return empty
 	}
 
 	body, _ := ioutil.ReadAll(resp.Body)
 	err = json.Unmarshal(body, &r)
 	if err != nil {
-		log.Printf("Decoder error: %+v\n", err)
-		log.Printf("Response body: %+v\n", string(body))
+		logger.Errorf("Decoder error: %+v", err)
+		logger.Debugf("Response body: %+v", string(body))
 		return empty
 	}
 	if r.Success != true {
 		body, _ := ioutil.ReadAll(resp.Body)
-		log.Printf("Response failed: %+v\n", string(body))
+		logger.Errorf("Response failed: %+v", string(body))
 		return empty
 
 	}
@@ -232,6 +528,9 @@ func (handler *Handler) updateRecord(record DNSRecord, newIP string)  string {
 
 	var r DNSRecordUpdateResponse
 	record.SetIP(newIP)
+	if handler.Configuration.Ownership.Enabled {
+		record.Comment = godns.MarkOwned(handler.Configuration, record.Comment)
+	}
 	var lastIP string
 
 	j, _ := json.Marshal(record)
@@ -241,23 +540,59 @@ func (handler *Handler) updateRecord(record DNSRecord, newIP string)  string {
 	)
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Request error:", err.Error())
+		logger.Error("Request error:", err.Error())
 		return ""
 	}
 
 	body, _ := ioutil.ReadAll(resp.Body)
 	err = json.Unmarshal(body, &r)
 	if err != nil {
-		log.Printf("Decoder error: %+v\n", err)
-		log.Printf("Response body: %+v\n", string(body))
+		logger.Errorf("Decoder error: %+v", err)
+		logger.Debugf("Response body: %+v", string(body))
 		return ""
 	}
 	if r.Success != true {
 		body, _ := ioutil.ReadAll(resp.Body)
-		log.Printf("Response failed: %+v\n", string(body))
+		logger.Errorf("Response failed: %+v", string(body))
 	} else {
-		log.Printf("Record updated: %+v - %+v", record.Name, record.IP)
+		logger.Infof("Record updated: %+v - %+v", record.Name, record.IP)
 		lastIP = record.IP
 	}
 	return lastIP
 }
+
+// Get a single DNS record by its ID
+func (handler *Handler) getDNSRecord(zoneID, recordID string) (DNSRecord, error) {
+	var r DNSRecordUpdateResponse
+
+	req, client := handler.newRequest("GET", "/zones/"+zoneID+"/dns_records/"+recordID, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return r.Record, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &r); err != nil {
+		return r.Record, err
+	}
+	if r.Success != true {
+		return r.Record, fmt.Errorf("response failed: %s", godns.Redact(string(body)))
+	}
+	return r.Record, nil
+}
+
+// Read back the content of an updated record
+func (handler *Handler) readBack(record DNSRecord) godns.ReadBackFunc {
+	return func() (string, error) {
+		rec, err := handler.getDNSRecord(record.ZoneID, record.ID)
+		return rec.IP, err
+	}
+}
+
+func (handler *Handler) recordType() string {
+	if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
+		return "AAAA"
+	}
+	return "A"
+}
@@ -2,6 +2,10 @@ package cloudflare
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -165,3 +169,50 @@ func TestRecordTracked(t *testing.T) {
 		}
 	}
 }
+
+func TestSetRecordOwnership(t *testing.T) {
+	var updates []DNSRecord
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/zones":
+			fmt.Fprint(w, `{"success": true, "result": [{"id": "zone1", "name": "example.com"}]}`)
+		case r.Method == "GET":
+			fmt.Fprint(w, `{"success": true, "result": [
+				{"id": "1", "zone_id": "zone1", "name": "manual.example.com", "type": "A", "content": "192.0.2.1"},
+				{"id": "2", "zone_id": "zone1", "name": "home.example.com", "type": "A", "content": "192.0.2.1", "comment": "heritage=godns,godns/owner=home"},
+				{"id": "3", "zone_id": "zone1", "name": "pinned.example.com", "type": "A", "content": "192.0.2.1", "comment": "pinned by ops"},
+				{"id": "4", "zone_id": "zone1", "name": "www.example.com", "type": "A", "content": "192.0.2.1", "comment": "heritage=godns,godns/owner=office"}]}`)
+		case r.Method == "PUT":
+			var record DNSRecord
+			json.NewDecoder(r.Body).Decode(&record)
+			updates = append(updates, record)
+			fmt.Fprint(w, `{"success": true, "result": {}}`)
+		}
+	}))
+	defer server.Close()
+
+	handler := &Handler{}
+	handler.SetConfiguration(&godns.Settings{
+		IPType:    godns.IPV4,
+		Ownership: godns.OwnershipSettings{Enabled: true, OwnerID: "office", Adopt: []string{"pinned.example.com"}},
+	})
+	handler.API = server.URL
+
+	for subDomain, owned := range map[string]bool{"manual": false, "home": false, "pinned": true, "www": true} {
+		if err := handler.SetRecord("example.com", subDomain, "192.0.2.2"); (err == nil) != owned {
+			t.Errorf("%s: expected owned %v, got %v", subDomain, owned, err)
+		}
+	}
+
+	comments := map[string]string{}
+	for _, record := range updates {
+		comments[record.Name] = record.Comment
+	}
+	expected := map[string]string{
+		"pinned.example.com": "pinned by ops heritage=godns,godns/owner=office",
+		"www.example.com":    "heritage=godns,godns/owner=office",
+	}
+	if !reflect.DeepEqual(comments, expected) {
+		t.Errorf("expected the updates %v, got %v", expected, comments)
+	}
+}
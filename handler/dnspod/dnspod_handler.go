@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"runtime/debug"
@@ -17,6 +16,34 @@ import (
 	"github.com/bitly/go-simplejson"
 )
 
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.DNSPOD)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.DNSPOD,
+		Description:  "DNSPod",
+		URL:          "https://www.dnspod.cn/",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "dnspod",
+		Credentials:  godns.DNSPodSettings{},
+		Validate:     validate,
+		Migrate:      migrate,
+		Capabilities: godns.Capabilities{IPv6: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.DNSPod.LoginToken == "" {
+		return errors.New("dnspod login token cannot be empty")
+	}
+	return nil
+}
+
+func migrate(config *godns.Settings) {
+	godns.MigrateCredential(config, &config.LoginToken, "login_token", &config.DNSPod.LoginToken, "dnspod.login_token")
+}
+
 // Handler struct definition
 type Handler struct {
 	Configuration *godns.Settings
@@ -29,9 +56,10 @@ func (handler *Handler) SetConfiguration(conf *godns.Settings) {
 
 // DomainLoop the main logic loop
 func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
 	defer func() {
 		if err := recover(); err != nil {
-			log.Printf("Recovered in %v: %v\n", err, debug.Stack())
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
 			panicChan <- *domain
 		}
 	}()
@@ -40,61 +68,70 @@ func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.
 	for {
 		if looping {
 			// Sleep with interval
-			log.Printf("Going to sleep, will start next checking in %d seconds...\r\n", handler.Configuration.Interval)
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
 			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
 		}
 
 		looping = true
 
-		log.Printf("Checking IP for domain %s \r\n", domain.DomainName)
+		logger.Infof("Checking IP for domain %s", domain.DomainName)
 		domainID := handler.GetDomain(domain.DomainName)
 
 		if domainID == -1 {
 			continue
 		}
 
-		currentIP, err := godns.GetCurrentIP(handler.Configuration)
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
 
 		if err != nil {
-			log.Println("get_currentIP:", err)
+			logger.Error("get_currentIP:", err)
 			continue
 		}
-		log.Println("currentIP is:", currentIP)
+		logger.Info("currentIP is:", currentIP)
 
 		for _, subDomain := range domain.SubDomains {
 			hostname := subDomain + "." + domain.DomainName
-			lastIP, err := godns.ResolveDNS(hostname, handler.Configuration.Resolver, handler.Configuration.IPType)
-			if err != nil {
-				log.Println(err)
-				continue
+
+			// the record is read at most once, it is needed for the update anyway
+			var subDomainID, ip string
+			fetched := false
+			getSubDomain := func() (string, string) {
+				if !fetched {
+					fetched = true
+					subDomainID, ip = handler.GetSubDomain(domainID, subDomain)
+				}
+				return subDomainID, ip
+			}
+			providerValue := func() (string, error) {
+				if _, ip := getSubDomain(); ip != "" {
+					return strings.TrimRight(ip, "\n"), nil
+				}
+				return "", errors.New("cannot get subdomain " + subDomain + " from DNSPod")
 			}
 
-			//check against currently known IP, if no change, skip update
-			if currentIP == lastIP {
-				log.Printf("IP is the same as cached one. Skip update.\n")
-			} else {
-				lastIP = currentIP
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, providerValue,
+				godns.CompareDNS, godns.CompareProviderAPI) {
+				continue
+			}
 
-				subDomainID, ip := handler.GetSubDomain(domainID, subDomain)
+			subDomainID, ip = getSubDomain()
+			if subDomainID == "" || ip == "" {
+				logger.Warnf("Domain or subdomain not configured yet. domain: %s.%s subDomainID: %s ip: %s", subDomain, domain.DomainName, subDomainID, ip)
+				continue
+			}
 
-				if subDomainID == "" || ip == "" {
-					log.Printf("Domain or subdomain not configured yet. domain: %s.%s subDomainID: %s ip: %s\n", subDomain, domain.DomainName, subDomainID, ip)
-					continue
-				}
+			logger.Infof("%s.%s Start to update record IP...", subDomain, domain.DomainName)
+			if err := handler.UpdateIP(domainID, subDomainID, subDomain, currentIP); err != nil {
+				logger.Error(err)
+				continue
+			}
 
-				// Continue to check the IP of subdomain
-				if len(ip) > 0 && strings.TrimRight(currentIP, "\n") != strings.TrimRight(ip, "\n") {
-					log.Printf("%s.%s Start to update record IP...\n", subDomain, domain.DomainName)
-					handler.UpdateIP(domainID, subDomainID, subDomain, currentIP)
-
-					// Send notification
-					if err := godns.SendNotify(handler.Configuration, fmt.Sprintf("%s.%s", subDomain, domain.DomainName), currentIP); err != nil {
-						log.Println("Failed to send notification")
-					}
-				} else {
-					log.Printf("%s.%s Current IP is same as domain IP, no need to update...\n", subDomain, domain.DomainName)
-				}
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Error("Failed to send notification")
 			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, handler.readBack(domainID, subDomain))
 		}
 	}
 }
@@ -102,8 +139,8 @@ func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.
 // GenerateHeader generates the request header for DNSPod API
 func (handler *Handler) GenerateHeader(content url.Values) url.Values {
 	header := url.Values{}
-	if handler.Configuration.LoginToken != "" {
-		header.Add("login_token", handler.Configuration.LoginToken)
+	if handler.Configuration.DNSPod.LoginToken != "" {
+		header.Add("login_token", handler.Configuration.DNSPod.LoginToken)
 	}
 
 	header.Add("format", "json")
@@ -131,14 +168,14 @@ func (handler *Handler) GetDomain(name string) int64 {
 	response, err := handler.PostData("/Domain.List", values)
 
 	if err != nil {
-		log.Println("Failed to get domain list...")
+		logger.Error("Failed to get domain list...")
 		return -1
 	}
 
 	sjson, parseErr := simplejson.NewJson([]byte(response))
 
 	if parseErr != nil {
-		log.Println(parseErr)
+		logger.Error(parseErr)
 		return -1
 	}
 
@@ -159,10 +196,10 @@ func (handler *Handler) GetDomain(name string) int64 {
 			}
 		}
 		if len(domains) == 0 {
-			log.Println("domains slice is empty.")
+			logger.Warn("domains slice is empty.")
 		}
 	} else {
-		log.Println("get_domain:status code:", sjson.Get("status").Get("code").MustString())
+		logger.Info("get_domain:status code:", sjson.Get("status").Get("code").MustString())
 	}
 
 	return ret
@@ -182,21 +219,21 @@ func (handler *Handler) GetSubDomain(domainID int64, name string) (string, strin
 	} else if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
 		value.Add("record_type", "AAAA")
 	} else {
-		log.Println("Error: must specify \"ip_type\" in config for DNSPod.")
+		logger.Error("Error: must specify \"ip_type\" in config for DNSPod.")
 		return "", ""
 	}
 
 	response, err := handler.PostData("/Record.List", value)
 
 	if err != nil {
-		log.Println("Failed to get domain list")
+		logger.Error("Failed to get domain list")
 		return "", ""
 	}
 
 	sjson, parseErr := simplejson.NewJson([]byte(response))
 
 	if parseErr != nil {
-		log.Println(parseErr)
+		logger.Error(parseErr)
 		return "", ""
 	}
 
@@ -212,17 +249,17 @@ func (handler *Handler) GetSubDomain(domainID int64, name string) (string, strin
 			}
 		}
 		if len(records) == 0 {
-			log.Println("records slice is empty.")
+			logger.Warn("records slice is empty.")
 		}
 	} else {
-		log.Println("get_subdomain:status code:", sjson.Get("status").Get("code").MustString())
+		logger.Info("get_subdomain:status code:", sjson.Get("status").Get("code").MustString())
 	}
 
 	return ret, ip
 }
 
 // UpdateIP update subdomain with current IP
-func (handler *Handler) UpdateIP(domainID int64, subDomainID string, subDomainName string, ip string) {
+func (handler *Handler) UpdateIP(domainID int64, subDomainID string, subDomainName string, ip string) error {
 	value := url.Values{}
 	value.Add("domain_id", strconv.FormatInt(domainID, 10))
 	value.Add("record_id", subDomainID)
@@ -233,8 +270,7 @@ func (handler *Handler) UpdateIP(domainID int64, subDomainID string, subDomainNa
 	} else if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
 		value.Add("record_type", "AAAA")
 	} else {
-		log.Println("Error: must specify \"ip_type\" in config for DNSPod.")
-		return
+		return errors.New("must specify \"ip_type\" in config for DNSPod")
 	}
 
 	value.Add("record_line", "默认")
@@ -243,34 +279,155 @@ func (handler *Handler) UpdateIP(domainID int64, subDomainID string, subDomainNa
 	response, err := handler.PostData("/Record.Modify", value)
 
 	if err != nil {
-		log.Println("Failed to update record to new IP!")
-		log.Println(err)
-		return
+		logger.Error("Failed to update record to new IP!")
+		return err
 	}
 
 	sjson, parseErr := simplejson.NewJson([]byte(response))
 
 	if parseErr != nil {
-		log.Println(parseErr)
-		return
+		return parseErr
 	}
 
-	if sjson.Get("status").Get("code").MustString() == "1" {
-		log.Println("New IP updated!")
-	} else {
-		log.Println("Failed to update IP record:", sjson.Get("status").Get("message").MustString())
+	if sjson.Get("status").Get("code").MustString() != "1" {
+		return errors.New("failed to update IP record: " + sjson.Get("status").Get("message").MustString())
+	}
+
+	logger.Info("New IP updated!")
+	return nil
+}
+
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	domainID := handler.GetDomain(domain)
+	if domainID <= 0 {
+		return errors.New("cannot get domain " + domain + " from DNSPod")
 	}
 
+	subDomainID, _ := handler.GetSubDomain(domainID, subDomain)
+	if subDomainID == "" {
+		return errors.New("cannot get subdomain " + subDomain + " from DNSPod")
+	}
+
+	return handler.UpdateIP(domainID, subDomainID, subDomain, ip)
+}
+
+// CheckAuth lists the domains of the account
+func (handler *Handler) CheckAuth() error {
+	values := url.Values{}
+	values.Add("type", "all")
+	values.Add("offset", "0")
+	values.Add("length", "1")
+
+	_, err := handler.call("/Domain.List", values)
+	return err
+}
+
+// CheckRecord checks that domain has the record of subDomain
+func (handler *Handler) CheckRecord(domain, subDomain string) error {
+	domainID := handler.GetDomain(domain)
+	if domainID <= 0 {
+		return errors.New("cannot get domain " + domain + " from DNSPod")
+	}
+
+	if subDomainID, _ := handler.GetSubDomain(domainID, subDomain); subDomainID == "" {
+		return errors.New("cannot get subdomain " + subDomain + " from DNSPod")
+	}
+	return nil
+}
+
+// ListZones lists the domains of the account
+func (handler *Handler) ListZones() ([]string, error) {
+	values := url.Values{}
+	values.Add("type", "all")
+	values.Add("offset", "0")
+	values.Add("length", "100")
+
+	sjson, err := handler.call("/Domain.List", values)
+	if err != nil {
+		return nil, err
+	}
+
+	var zones []string
+	domains, _ := sjson.Get("domains").Array()
+	for _, d := range domains {
+		if name, ok := d.(map[string]interface{})["name"].(string); ok {
+			zones = append(zones, name)
+		}
+	}
+	return zones, nil
+}
+
+// ListRecords lists the records of zone, of all types
+func (handler *Handler) ListRecords(zone string) ([]godns.Record, error) {
+	domainID := handler.GetDomain(zone)
+	if domainID <= 0 {
+		return nil, errors.New("cannot get domain " + zone + " from DNSPod")
+	}
+
+	values := url.Values{}
+	values.Add("domain_id", strconv.FormatInt(domainID, 10))
+	values.Add("offset", "0")
+	values.Add("length", "500")
+
+	sjson, err := handler.call("/Record.List", values)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []godns.Record
+	list, _ := sjson.Get("records").Array()
+	for i := range list {
+		rec := sjson.Get("records").GetIndex(i)
+		name := rec.Get("name").MustString()
+		if name == "@" {
+			name = zone
+		} else {
+			name += "." + zone
+		}
+		ttl, _ := strconv.Atoi(rec.Get("ttl").MustString())
+		records = append(records, godns.Record{
+			Name:  name,
+			Type:  rec.Get("type").MustString(),
+			Value: rec.Get("value").MustString(),
+			TTL:   ttl,
+		})
+	}
+	return records, nil
+}
+
+// call invokes the DNSPod API and checks the status of the response
+func (handler *Handler) call(url string, content url.Values) (*simplejson.Json, error) {
+	response, err := handler.PostData(url, content)
+	if err != nil {
+		return nil, err
+	}
+
+	sjson, err := simplejson.NewJson([]byte(response))
+	if err != nil {
+		return nil, err
+	}
+	if sjson.Get("status").Get("code").MustString() != "1" {
+		return nil, errors.New(sjson.Get("status").Get("message").MustString())
+	}
+	return sjson, nil
+}
+
+// readBack reads the value of an updated subdomain back from DNSPod
+func (handler *Handler) readBack(domainID int64, subDomain string) godns.ReadBackFunc {
+	return func() (string, error) {
+		_, ip := handler.GetSubDomain(domainID, subDomain)
+		if ip == "" {
+			return "", errors.New("cannot get subdomain " + subDomain + " from DNSPod")
+		}
+		return ip, nil
+	}
 }
 
 // PostData post data and invoke DNSPod API
 func (handler *Handler) PostData(url string, content url.Values) (string, error) {
 	client := godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
 
-	if client == nil {
-		return "", errors.New("failed to create HTTP client")
-	}
-
 	values := handler.GenerateHeader(content)
 	req, _ := http.NewRequest("POST", "https://dnsapi.cn"+url, strings.NewReader(values.Encode()))
 
@@ -280,8 +437,8 @@ func (handler *Handler) PostData(url string, content url.Values) (string, error)
 	response, err := client.Do(req)
 
 	if err != nil {
-		log.Println("Post failed...")
-		log.Println(err)
+		logger.Error("Post failed...")
+		logger.Error(err)
 		return "", err
 	}
 
@@ -1,9 +1,10 @@
 package dreamhost
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"runtime/debug"
@@ -19,11 +20,52 @@ var (
 	DreamhostURL = "https://api.dreamhost.com"
 )
 
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.DREAMHOST)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.DREAMHOST,
+		Description:  "Dreamhost",
+		URL:          "https://www.dreamhost.com",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "dreamhost",
+		Credentials:  godns.DreamhostSettings{},
+		Validate:     validate,
+		Migrate:      migrate,
+		Capabilities: godns.Capabilities{IPv6: true, CreateRecords: true, Membership: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.Dreamhost.APIKey == "" {
+		return errors.New("dreamhost api key cannot be empty")
+	}
+	return nil
+}
+
+func migrate(config *godns.Settings) {
+	godns.MigrateCredential(config, &config.LoginToken, "login_token", &config.Dreamhost.APIKey, "dreamhost.api_key")
+}
+
 // Handler struct
 type Handler struct {
 	Configuration *godns.Settings
 }
 
+// Record is a DNS record as listed by the Dreamhost API
+type Record struct {
+	Zone   string `json:"zone"`
+	Record string `json:"record"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+}
+
+type listRecordsResponse struct {
+	Result string   `json:"result"`
+	Data   []Record `json:"data"`
+}
+
 // SetConfiguration pass dns settings and store it to handler instance
 func (handler *Handler) SetConfiguration(conf *godns.Settings) {
 	handler.Configuration = conf
@@ -31,9 +73,10 @@ func (handler *Handler) SetConfiguration(conf *godns.Settings) {
 
 // DomainLoop the main logic loop
 func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
 	defer func() {
 		if err := recover(); err != nil {
-			log.Printf("Recovered in %v: %v\n", err, debug.Stack())
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
 			panicChan <- *domain
 		}
 	}()
@@ -42,66 +85,143 @@ func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.
 	for {
 		if looping {
 			// Sleep with interval
-			log.Printf("Going to sleep, will start next checking in %d seconds...\r\n", handler.Configuration.Interval)
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
 			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
 		}
 		looping = true
 
-		currentIP, err := godns.GetCurrentIP(handler.Configuration)
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
 
 		if err != nil {
-			log.Println("get_currentIP:", err)
+			logger.Error("get_currentIP:", err)
 			continue
 		}
-		log.Println("currentIP is:", currentIP)
+		logger.Info("currentIP is:", currentIP)
+
+		// the records are listed at most once per loop
+		var records []Record
+		fetched := false
+		getRecord := func(hostname string) (string, error) {
+			if !fetched {
+				fetched = true
+				if records, err = handler.listRecords(); err != nil {
+					logger.Error("Failed to list records:", err)
+				}
+			}
+			for _, rec := range records {
+				if rec.Record == hostname && rec.Type == handler.recordType() {
+					return rec.Value, nil
+				}
+			}
+			return "", fmt.Errorf("record %s not found", hostname)
+		}
 
 		for _, subDomain := range domain.SubDomains {
-			hostname := subDomain + "." + domain.DomainName
-			lastIP, err := godns.ResolveDNS(hostname, handler.Configuration.Resolver, handler.Configuration.IPType)
-			if err != nil {
-				log.Println(err)
+			if domain.IsMember(subDomain) {
+				if err := godns.UpdateMember(handler.Configuration, handler, domain, subDomain, currentIP); err != nil {
+					logger.Error("Failed to update the membership of", subDomain+":", err)
+				}
 				continue
 			}
 
-			//check against currently known IP, if no change, skip update
-			if currentIP == lastIP {
-				log.Printf("IP is the same as cached one. Skip update.\n")
-			} else {
-				log.Printf("%s.%s Start to update record IP...\n", subDomain, domain.DomainName)
-				handler.UpdateIP(hostname, currentIP, lastIP)
+			hostname := subDomain + "." + domain.DomainName
+			providerValue := func() (string, error) {
+				return getRecord(hostname)
+			}
 
-				// Send notification
-				if err := godns.SendNotify(handler.Configuration, fmt.Sprintf("%s.%s", subDomain, domain.DomainName), currentIP); err != nil {
-					log.Println("Failed to send notification")
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, providerValue, godns.CompareDNS) {
+				continue
+			}
+
+			// the old value has to be removed, find it wherever it is known
+			lastIP, err := getRecord(hostname)
+			if err != nil {
+				if state, ok := godns.GetStateStore(handler.Configuration).Get(hostname); ok {
+					lastIP = state.IP
+				} else {
+					lastIP, _ = godns.ResolveDNS(hostname, handler.Configuration.Resolver, handler.Configuration.IPType)
 				}
 			}
+
+			logger.Infof("%s.%s Start to update record IP...", subDomain, domain.DomainName)
+			if err := handler.UpdateIP(hostname, currentIP, lastIP); err != nil {
+				logger.Error("Update IP failed:", err)
+				continue
+			}
+
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Error("Failed to send notification")
+			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, nil)
 		}
 	}
 
 }
 
 // UpdateIP update subdomain with current IP
-func (handler *Handler) UpdateIP(hostname, currentIP, lastIP string) {
+func (handler *Handler) UpdateIP(hostname, currentIP, lastIP string) error {
+	// a failed removal is not fatal, the old value may already be gone
+	if err := handler.updateDNS(lastIP, currentIP, hostname, "remove"); err != nil {
+		logger.Warn("Remove the old record failed:", err)
+	}
+	return handler.updateDNS(lastIP, currentIP, hostname, "add")
+}
 
-	handler.updateDNS(lastIP, currentIP, hostname, "remove")
-	handler.updateDNS(lastIP, currentIP, hostname, "add")
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	hostname := subDomain + "." + domain
+
+	records, err := handler.listRecords()
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range records {
+		if rec.Record == hostname && rec.Type == handler.recordType() {
+			if rec.Value == ip {
+				return nil
+			}
+			return handler.UpdateIP(hostname, ip, rec.Value)
+		}
+	}
 
+	return handler.updateDNS("", ip, hostname, "add")
 }
 
-// updateDNS can add or remove DNS records.
-func (handler *Handler) updateDNS(dns, ip, hostname, action string) {
-	ipType := "A"
-	if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
-		ipType = "AAAA"
+// ListMembers returns the values of the records of subDomain
+func (handler *Handler) ListMembers(domain, subDomain string) ([]string, error) {
+	records, err := handler.listRecords()
+	if err != nil {
+		return nil, err
 	}
 
-	// Generates UUID
-	uid, _ := uuid.NewRandom()
+	hostname := subDomain + "." + domain
+	var members []string
+	for _, rec := range records {
+		if rec.Record == hostname && rec.Type == handler.recordType() {
+			members = append(members, rec.Value)
+		}
+	}
+	return members, nil
+}
+
+// AddMember adds a record of subDomain with ip, besides the others
+func (handler *Handler) AddMember(domain, subDomain, ip string) error {
+	return handler.updateDNS("", ip, subDomain+"."+domain, "add")
+}
+
+// RemoveMember removes the record of subDomain with ip, leaving the others
+func (handler *Handler) RemoveMember(domain, subDomain, ip string) error {
+	return handler.updateDNS(ip, "", subDomain+"."+domain, "remove")
+}
+
+// updateDNS can add or remove DNS records.
+func (handler *Handler) updateDNS(dns, ip, hostname, action string) error {
 	values := url.Values{}
 	values.Add("record", hostname)
-	values.Add("key", handler.Configuration.LoginToken)
-	values.Add("type", ipType)
-	values.Add("unique_id", uid.String())
+	values.Add("type", handler.recordType())
 	switch action {
 	case "remove":
 		// Build URL query (remove)
@@ -112,27 +232,125 @@ func (handler *Handler) updateDNS(dns, ip, hostname, action string) {
 		values.Add("cmd", "dns-add_record")
 		values.Add("value", ip)
 	default:
-		log.Fatalf("Unknown action %s\n", action)
+		return fmt.Errorf("unknown action %s", action)
 	}
 
-	client := godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
-	req, _ := http.NewRequest("POST", DreamhostURL, strings.NewReader(values.Encode()))
-	req.SetBasicAuth(handler.Configuration.Email, handler.Configuration.Password)
+	body, err := handler.request(values)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("Update IP success:", string(body))
+	return nil
+}
+
+// CheckAuth lists the records of the account
+func (handler *Handler) CheckAuth() error {
+	_, err := handler.listRecords()
+	return err
+}
 
-	if handler.Configuration.UserAgent != "" {
-		req.Header.Add("User-Agent", handler.Configuration.UserAgent)
+// CheckRecord checks that the account has the record of subDomain
+func (handler *Handler) CheckRecord(domain, subDomain string) error {
+	records, err := handler.listRecords()
+	if err != nil {
+		return err
 	}
 
-	resp, err := client.Do(req)
+	hostname := subDomain + "." + domain
+	for _, rec := range records {
+		if rec.Record == hostname && rec.Type == handler.recordType() {
+			return nil
+		}
+	}
+	return fmt.Errorf("no %s record %s", handler.recordType(), hostname)
+}
+
+// ListZones lists the zones of the account
+func (handler *Handler) ListZones() ([]string, error) {
+	list, err := handler.listRecords()
 	if err != nil {
-		log.Println("Request error...")
-		log.Println("Err:", err.Error())
-	} else {
-		body, _ := ioutil.ReadAll(resp.Body)
-		if resp.StatusCode == http.StatusOK {
-			log.Println("Update IP success:", string(body))
-		} else {
-			log.Println("Update IP failed:", string(body))
+		return nil, err
+	}
+
+	var zones []string
+	seen := map[string]bool{}
+	for _, rec := range list {
+		if !seen[rec.Zone] {
+			seen[rec.Zone] = true
+			zones = append(zones, rec.Zone)
 		}
 	}
+	return zones, nil
+}
+
+// ListRecords lists the records of zone, of all types
+func (handler *Handler) ListRecords(zone string) ([]godns.Record, error) {
+	list, err := handler.listRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []godns.Record
+	for _, rec := range list {
+		if rec.Zone == zone {
+			records = append(records, godns.Record{Name: rec.Record, Type: rec.Type, Value: rec.Value})
+		}
+	}
+	return records, nil
+}
+
+// listRecords lists all the DNS records of the account
+func (handler *Handler) listRecords() ([]Record, error) {
+	values := url.Values{}
+	values.Add("cmd", "dns-list_records")
+	values.Add("format", "json")
+
+	body, err := handler.request(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp listRecordsResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Result != "success" {
+		return nil, fmt.Errorf("list records failed: %s", godns.Redact(string(body)))
+	}
+
+	return resp.Data, nil
+}
+
+// request invokes the Dreamhost API with values
+func (handler *Handler) request(values url.Values) ([]byte, error) {
+	// Generates UUID
+	uid, _ := uuid.NewRandom()
+	values.Add("key", handler.Configuration.Dreamhost.APIKey)
+	values.Add("unique_id", uid.String())
+
+	client := godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
+	req, _ := http.NewRequest("POST", DreamhostURL, strings.NewReader(values.Encode()))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error("Request error...")
+		logger.Error("Err:", err.Error())
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("status %d: %s", resp.StatusCode, godns.Redact(string(body)))
+	}
+
+	return body, nil
+}
+
+func (handler *Handler) recordType() string {
+	if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
+		return "AAAA"
+	}
+	return "A"
 }
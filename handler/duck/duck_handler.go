@@ -1,9 +1,9 @@
 package duck
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"runtime/debug"
 	"strings"
 	"time"
@@ -16,6 +16,34 @@ var (
 	DuckUrl = "https://www.duckdns.org/update?domains=%s&token=%s&%s"
 )
 
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.DUCK)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.DUCK,
+		Description:  "DuckDNS",
+		URL:          "https://www.duckdns.org",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "duckdns",
+		Credentials:  godns.DuckDNSSettings{},
+		Validate:     validate,
+		Migrate:      migrate,
+		Capabilities: godns.Capabilities{IPv6: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.DuckDNS.Token == "" {
+		return errors.New("duckdns token cannot be empty")
+	}
+	return nil
+}
+
+func migrate(config *godns.Settings) {
+	godns.MigrateCredential(config, &config.LoginToken, "login_token", &config.DuckDNS.Token, "duckdns.token")
+}
+
 // Handler struct
 type Handler struct {
 	Configuration *godns.Settings
@@ -28,9 +56,10 @@ func (handler *Handler) SetConfiguration(conf *godns.Settings) {
 
 // DomainLoop the main logic loop
 func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
 	defer func() {
 		if err := recover(); err != nil {
-			log.Printf("Recovered in %v: %v\n", err, debug.Stack())
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
 			panicChan <- *domain
 		}
 	}()
@@ -40,63 +69,76 @@ func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.
 	for {
 		if looping {
 			// Sleep with interval
-			log.Printf("Going to sleep, will start next checking in %d seconds...\r\n", handler.Configuration.Interval)
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
 			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
 		}
 
 		looping = true
-		currentIP, err := godns.GetCurrentIP(handler.Configuration)
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
 
 		if err != nil {
-			log.Println("get_currentIP:", err)
+			logger.Error("get_currentIP:", err)
 			continue
 		}
 
-		log.Println("currentIP is:", currentIP)
-		client := godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
-		var ip string
-
-		if strings.ToUpper(handler.Configuration.IPType) == godns.IPV4 {
-			ip = fmt.Sprintf("ip=%s", currentIP)
-		} else if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
-			ip = fmt.Sprintf("ipv6=%s", currentIP)
-		}
+		logger.Info("currentIP is:", currentIP)
 
 		for _, subDomain := range domain.SubDomains {
 			hostname := subDomain + "." + domain.DomainName
-			lastIP, err := godns.ResolveDNS(hostname, handler.Configuration.Resolver, handler.Configuration.IPType)
-			if err != nil {
-				log.Println(err)
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, nil, godns.CompareDNS) {
+				continue
+			}
+
+			if err := handler.UpdateIP(subDomain, currentIP); err != nil {
+				logger.Error("Failed to update the IP:", err)
 				continue
 			}
 
-			//check against currently known IP, if no change, skip update
-			if currentIP == lastIP {
-				log.Printf("IP is the same as cached one. Skip update.\n")
-			} else {
-				// update IP with HTTP GET request
-				resp, err := client.Get(fmt.Sprintf(DuckUrl, subDomain, handler.Configuration.LoginToken, ip))
-				if err != nil {
-					// handle error
-					log.Print("Failed to update sub domain:", subDomain)
-					continue
-				}
-
-				defer resp.Body.Close()
-
-				body, err := ioutil.ReadAll(resp.Body)
-				if err != nil || string(body) != "OK" {
-					log.Println("Failed to update the IP")
-					continue
-				} else {
-					log.Print("IP updated to:", currentIP)
-				}
-
-				// Send notification
-				if err := godns.SendNotify(handler.Configuration, fmt.Sprintf("%s.%s", subDomain, domain.DomainName), currentIP); err != nil {
-					log.Println("Failed to send notification")
-				}
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Error("Failed to send notification")
 			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, nil)
 		}
 	}
 }
+
+// UpdateIP update subdomain with current IP
+func (handler *Handler) UpdateIP(subDomain, currentIP string) error {
+	client := godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
+	var ip string
+
+	if strings.ToUpper(handler.Configuration.IPType) == godns.IPV4 {
+		ip = fmt.Sprintf("ip=%s", currentIP)
+	} else if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
+		ip = fmt.Sprintf("ipv6=%s", currentIP)
+	}
+
+	// update IP with HTTP GET request
+	resp, err := client.Get(fmt.Sprintf(DuckUrl, subDomain, handler.Configuration.DuckDNS.Token, ip))
+	if err != nil {
+		// handle error
+		logger.Error("Failed to update sub domain:", subDomain)
+		// the URL of the error holds the token
+		return godns.RedactError(err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if string(body) != "OK" {
+		return fmt.Errorf("unexpected response: %s", godns.Redact(string(body)))
+	}
+
+	logger.Info("IP updated to:", currentIP)
+	return nil
+}
+
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	return handler.UpdateIP(subDomain, ip)
+}
@@ -0,0 +1,125 @@
+package dyndns2
+
+import (
+	"errors"
+	"runtime/debug"
+	"time"
+
+	"github.com/jmbayu/godns"
+	protocol "github.com/jmbayu/godns/dyndns2"
+)
+
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.DYNDNS2)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.DYNDNS2,
+		Description:  "Any dyndns2 compatible service",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "dyndns2",
+		Credentials:  godns.DynDNS2Settings{},
+		Validate:     validate,
+		Migrate:      migrate,
+		Capabilities: godns.Capabilities{IPv6: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.DynDNS2.URL == "" {
+		return errors.New("dyndns2 url cannot be empty")
+	}
+	if config.DynDNS2.Username == "" {
+		return errors.New("dyndns2 username cannot be empty")
+	}
+	if config.DynDNS2.Password == "" {
+		return errors.New("dyndns2 password cannot be empty")
+	}
+	return nil
+}
+
+func migrate(config *godns.Settings) {
+	godns.MigrateCredential(config, &config.Email, "email", &config.DynDNS2.Username, "dyndns2.username")
+	godns.MigrateCredential(config, &config.Password, "password", &config.DynDNS2.Password, "dyndns2.password")
+}
+
+// Handler struct
+type Handler struct {
+	Configuration *godns.Settings
+	client        *protocol.Client
+}
+
+// SetConfiguration pass dns settings and store it to handler instance
+func (handler *Handler) SetConfiguration(conf *godns.Settings) {
+	handler.Configuration = conf
+	handler.client = protocol.NewClient(conf.DynDNS2.URL, conf.DynDNS2.Username, conf.DynDNS2.Password, godns.GetHttpClient(conf, conf.UseProxy))
+	handler.client.UserAgent = conf.UserAgent
+}
+
+// DomainLoop the main logic loop
+func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
+			panicChan <- *domain
+		}
+	}()
+
+	looping := false
+
+	for {
+		if looping {
+			// Sleep with interval
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
+			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
+		}
+
+		looping = true
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
+
+		if err != nil {
+			logger.Error("get_currentIP:", err)
+			continue
+		}
+
+		logger.Info("currentIP is:", currentIP)
+
+		for _, subDomain := range domain.SubDomains {
+			hostname := subDomain + "." + domain.DomainName
+			if _, suspended := handler.client.Suspended(hostname); suspended {
+				continue
+			}
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, nil, godns.CompareDNS) {
+				continue
+			}
+
+			if err := handler.UpdateIP(hostname, currentIP); err != nil {
+				logger.Error("Failed to update the IP:", err)
+				continue
+			}
+
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Error("Failed to send notification")
+			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, nil)
+		}
+	}
+}
+
+// UpdateIP update hostname with current IP
+func (handler *Handler) UpdateIP(hostname, currentIP string) error {
+	if _, err := handler.client.Update(hostname, currentIP); err != nil {
+		return err
+	}
+
+	logger.Info("IP updated to:", currentIP)
+	return nil
+}
+
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	return handler.UpdateIP(subDomain+"."+domain, ip)
+}
@@ -1,37 +1,70 @@
 package google
 
 import (
-	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"errors"
 	"runtime/debug"
-	"strings"
 	"time"
 
 	"github.com/jmbayu/godns"
+	"github.com/jmbayu/godns/dyndns2"
 )
 
 var (
 	// GoogleURL the API address for Google Domains
-	GoogleURL = "https://%s:%s@domains.google.com/nic/update?hostname=%s.%s&myip=%s"
+	GoogleURL = "https://domains.google.com/nic/update"
 )
 
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.GOOGLE)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.GOOGLE,
+		Description:  "Google Domains",
+		URL:          "https://domains.google",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "google",
+		Credentials:  godns.GoogleSettings{},
+		Validate:     validate,
+		Migrate:      migrate,
+		Capabilities: godns.Capabilities{IPv6: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.Google.Username == "" {
+		return errors.New("google username cannot be empty")
+	}
+	if config.Google.Password == "" {
+		return errors.New("google password cannot be empty")
+	}
+	return nil
+}
+
+func migrate(config *godns.Settings) {
+	godns.MigrateCredential(config, &config.Email, "email", &config.Google.Username, "google.username")
+	godns.MigrateCredential(config, &config.Password, "password", &config.Google.Password, "google.password")
+}
+
 // Handler struct
 type Handler struct {
 	Configuration *godns.Settings
+	client        *dyndns2.Client
 }
 
 // SetConfiguration pass dns settings and store it to handler instance
 func (handler *Handler) SetConfiguration(conf *godns.Settings) {
 	handler.Configuration = conf
+	handler.client = dyndns2.NewClient(GoogleURL, conf.Google.Username, conf.Google.Password, godns.GetHttpClient(conf, conf.UseProxy))
+	handler.client.UserAgent = conf.UserAgent
 }
 
 // DomainLoop the main logic loop
 func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
 	defer func() {
 		if err := recover(); err != nil {
-			log.Printf("Recovered in %v: %v\n", err, debug.Stack())
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
 			panicChan <- *domain
 		}
 	}()
@@ -41,73 +74,59 @@ func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.
 	for {
 		if looping {
 			// Sleep with interval
-			log.Printf("Going to sleep, will start next checking in %d seconds...\r\n", handler.Configuration.Interval)
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
 			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
 		}
 
 		looping = true
-		currentIP, err := godns.GetCurrentIP(handler.Configuration)
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
 		if err != nil {
-			log.Println("get_currentIP:", err)
+			logger.Error("get_currentIP:", err)
 			continue
 		}
-		log.Println("currentIP is:", currentIP)
+		logger.Info("currentIP is:", currentIP)
 		for _, subDomain := range domain.SubDomains {
 			hostname := subDomain + "." + domain.DomainName
-			lastIP, err := godns.ResolveDNS(hostname, handler.Configuration.Resolver, handler.Configuration.IPType)
-			if err != nil {
-				log.Println(err)
+			if _, suspended := handler.client.Suspended(hostname); suspended {
+				continue
+			}
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, nil, godns.CompareDNS) {
 				continue
 			}
 
-			//check against currently known IP, if no change, skip update
-			if currentIP == lastIP {
-				log.Printf("IP is the same as cached one. Skip update.\n")
-			} else {
-				log.Printf("%s.%s Start to update record IP...\n", subDomain, domain.DomainName)
-				handler.UpdateIP(domain.DomainName, subDomain, currentIP)
-
-				// Send notification
-				if err := godns.SendNotify(handler.Configuration, fmt.Sprintf("%s.%s", subDomain, domain.DomainName), currentIP); err != nil {
-					log.Println("Failed to send notification")
-				}
+			logger.Infof("%s.%s Start to update record IP...", subDomain, domain.DomainName)
+			if err := handler.UpdateIP(domain.DomainName, subDomain, currentIP); err != nil {
+				continue
 			}
+
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Error("Failed to send notification")
+			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, nil)
 		}
 	}
 
 }
 
 // UpdateIP update subdomain with current IP
-func (handler *Handler) UpdateIP(domain, subDomain, currentIP string) {
-	client := godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
-	resp, err := client.Get(fmt.Sprintf(GoogleURL,
-		handler.Configuration.Email,
-		handler.Configuration.Password,
-		subDomain,
-		domain,
-		currentIP))
-
+func (handler *Handler) UpdateIP(domain, subDomain, currentIP string) error {
+	result, err := handler.client.Update(subDomain+"."+domain, currentIP)
 	if err != nil {
-		// handle error
-		log.Print("Failed to update sub domain:", subDomain)
-		return
+		logger.Error("Update IP failed:", err)
+		return err
 	}
 
-	defer resp.Body.Close()
-
-	if err != nil {
-		log.Println("Request error...")
-		log.Println("Err:", err.Error())
+	if result.Code == dyndns2.NoChg {
+		logger.Info("IP not changed:", result.IP)
 	} else {
-		body, _ := ioutil.ReadAll(resp.Body)
-		if resp.StatusCode == http.StatusOK {
-			if strings.Contains(string(body), "good") {
-				log.Println("Update IP success:", string(body))
-			} else if strings.Contains(string(body), "nochg") {
-				log.Println("IP not changed:", string(body))
-			}
-		} else {
-			log.Println("Update IP failed:", string(body))
-		}
+		logger.Info("Update IP success:", result.IP)
 	}
+	return nil
+}
+
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	return handler.UpdateIP(domain, subDomain, ip)
 }
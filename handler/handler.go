@@ -2,14 +2,6 @@ package handler
 
 import (
 	"github.com/jmbayu/godns"
-	"github.com/jmbayu/godns/handler/alidns"
-	"github.com/jmbayu/godns/handler/cloudflare"
-	"github.com/jmbayu/godns/handler/dnspod"
-	"github.com/jmbayu/godns/handler/dreamhost"
-	"github.com/jmbayu/godns/handler/duck"
-	"github.com/jmbayu/godns/handler/google"
-	"github.com/jmbayu/godns/handler/he"
-	"github.com/jmbayu/godns/handler/noip"
 )
 
 // IHandler is the interface for all DNS handlers
@@ -18,28 +10,47 @@ type IHandler interface {
 	DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain)
 }
 
-// CreateHandler creates DNS handler by different providers
+// IRecordSetter is implemented by the handlers which can set a single record on demand
+type IRecordSetter interface {
+	SetRecord(domain, subDomain, ip string) error
+}
+
+// IChecker is implemented by the handlers which can check their settings
+// against the provider without changing any record
+type IChecker interface {
+	// CheckAuth authenticates to the provider
+	CheckAuth() error
+	// CheckRecord checks that the record of subDomain exists with the type
+	// of ip_type
+	CheckRecord(domain, subDomain string) error
+}
+
+// IRecordLister is implemented by the handlers which can list the zones of
+// the account and their records
+type IRecordLister interface {
+	ListZones() ([]string, error)
+	ListRecords(zone string) ([]godns.Record, error)
+}
+
+// IRecordGetter is implemented by the handlers which can read the records
+// of a single subdomain
+type IRecordGetter interface {
+	GetRecords(domain, subDomain string) ([]godns.Record, error)
+}
+
+// IMemberSetter is implemented by the handlers which can add and remove
+// single addresses of round-robin records, it is defined by godns for the
+// handlers to share UpdateMember
+type IMemberSetter = godns.MemberSetter
+
+// CreateHandler creates DNS handler by different providers. Providers are
+// compiled in by the provider_*.go files, each one can be left out with its
+// build tag, such as no_cloudflare.
 func CreateHandler(provider string) IHandler {
-	var handler IHandler
-
-	switch provider {
-	case godns.CLOUDFLARE:
-		handler = IHandler(&cloudflare.Handler{})
-	case godns.DNSPOD:
-		handler = IHandler(&dnspod.Handler{})
-	case godns.DREAMHOST:
-		handler = IHandler(&dreamhost.Handler{})
-	case godns.HE:
-		handler = IHandler(&he.Handler{})
-	case godns.ALIDNS:
-		handler = IHandler(&alidns.Handler{})
-	case godns.GOOGLE:
-		handler = IHandler(&google.Handler{})
-	case godns.DUCK:
-		handler = IHandler(&duck.Handler{})
-	case godns.NOIP:
-		handler = IHandler(&noip.Handler{})
+	p, ok := godns.LookupProvider(provider)
+	if !ok {
+		return nil
 	}
 
-	return handler
+	return IHandler(p.New())
 }
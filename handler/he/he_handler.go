@@ -1,9 +1,9 @@
 package he
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"runtime/debug"
@@ -18,6 +18,34 @@ var (
 	HEUrl = "https://dyn.dns.he.net/nic/update"
 )
 
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.HE)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.HE,
+		Description:  "HE.net (Hurricane Electric)",
+		URL:          "https://dns.he.net/",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "he",
+		Credentials:  godns.HESettings{},
+		Validate:     validate,
+		Migrate:      migrate,
+		Capabilities: godns.Capabilities{IPv6: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.HE.DDNSKey == "" {
+		return errors.New("he ddns key cannot be empty")
+	}
+	return nil
+}
+
+func migrate(config *godns.Settings) {
+	godns.MigrateCredential(config, &config.Password, "password", &config.HE.DDNSKey, "he.ddns_key")
+}
+
 // Handler struct
 type Handler struct {
 	Configuration *godns.Settings
@@ -30,9 +58,10 @@ func (handler *Handler) SetConfiguration(conf *godns.Settings) {
 
 // DomainLoop the main logic loop
 func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
 	defer func() {
 		if err := recover(); err != nil {
-			log.Printf("Recovered in %v: %v\n", err, debug.Stack())
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
 			panicChan <- *domain
 		}
 	}()
@@ -41,51 +70,48 @@ func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.
 	for {
 		if looping {
 			// Sleep with interval
-			log.Printf("Going to sleep, will start next checking in %d seconds...\r\n", handler.Configuration.Interval)
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
 			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
 		}
 		looping = true
 
-		currentIP, err := godns.GetCurrentIP(handler.Configuration)
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
 
 		if err != nil {
-			log.Println("get_currentIP:", err)
+			logger.Error("get_currentIP:", err)
 			continue
 		}
-		log.Println("currentIP is:", currentIP)
+		logger.Info("currentIP is:", currentIP)
 
 		//check against locally cached IP, if no change, skip update
 
 		for _, subDomain := range domain.SubDomains {
 			hostname := subDomain + "." + domain.DomainName
-			lastIP, err := godns.ResolveDNS(hostname, handler.Configuration.Resolver, handler.Configuration.IPType)
-			if err != nil {
-				log.Println(err)
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, nil, godns.CompareDNS) {
 				continue
 			}
 
-			//check against currently known IP, if no change, skip update
-			if currentIP == lastIP {
-				log.Printf("IP is the same as cached one. Skip update.\n")
-			} else {
-				log.Printf("%s.%s Start to update record IP...\n", subDomain, domain.DomainName)
-				handler.UpdateIP(domain.DomainName, subDomain, currentIP)
-
-				// Send notification
-				if err := godns.SendNotify(handler.Configuration, fmt.Sprintf("%s.%s", subDomain, domain.DomainName), currentIP); err != nil {
-					log.Println("Failed to send notification")
-				}
+			logger.Infof("%s.%s Start to update record IP...", subDomain, domain.DomainName)
+			if err := handler.UpdateIP(domain.DomainName, subDomain, currentIP); err != nil {
+				continue
 			}
+
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Error("Failed to send notification")
+			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, nil)
 		}
 	}
 
 }
 
 // UpdateIP update subdomain with current IP
-func (handler *Handler) UpdateIP(domain, subDomain, currentIP string) {
+func (handler *Handler) UpdateIP(domain, subDomain, currentIP string) error {
 	values := url.Values{}
 	values.Add("hostname", fmt.Sprintf("%s.%s", subDomain, domain))
-	values.Add("password", handler.Configuration.Password)
+	values.Add("password", handler.Configuration.HE.DDNSKey)
 	values.Add("myip", currentIP)
 
 	client := godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
@@ -94,14 +120,23 @@ func (handler *Handler) UpdateIP(domain, subDomain, currentIP string) {
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Println("Request error...")
-		log.Println("Err:", err.Error())
-	} else {
-		body, _ := ioutil.ReadAll(resp.Body)
-		if resp.StatusCode == http.StatusOK {
-			log.Println("Update IP success:", string(body))
-		} else {
-			log.Println("Update IP failed:", string(body))
-		}
+		logger.Error("Request error...")
+		logger.Error("Err:", err.Error())
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		logger.Error("Update IP failed:", string(body))
+		return fmt.Errorf("update IP failed: %s", godns.Redact(string(body)))
 	}
+
+	logger.Debug("Update IP success:", string(body))
+	return nil
+}
+
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	return handler.UpdateIP(domain, subDomain, ip)
 }
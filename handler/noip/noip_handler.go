@@ -1,37 +1,71 @@
 package noip
 
 import (
-	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"errors"
 	"runtime/debug"
-	"strings"
 	"time"
 
 	"github.com/jmbayu/godns"
+	"github.com/jmbayu/godns/dyndns2"
 )
 
 var (
 	// NoIPUrl the API address for NoIP
-	NoIPUrl = "https://%s:%s@dynupdate.no-ip.com/nic/update?hostname=%s&%s"
+	NoIPUrl = "https://dynupdate.no-ip.com/nic/update"
 )
 
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.NOIP)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.NOIP,
+		Description:  "No-IP",
+		URL:          "https://www.noip.com/",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "noip",
+		Credentials:  godns.NoIPSettings{},
+		Validate:     validate,
+		Migrate:      migrate,
+		Capabilities: godns.Capabilities{IPv6: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.NoIP.Username == "" {
+		return errors.New("noip username cannot be empty")
+	}
+	if config.NoIP.Password == "" {
+		return errors.New("noip password cannot be empty")
+	}
+	return nil
+}
+
+func migrate(config *godns.Settings) {
+	godns.MigrateCredential(config, &config.Email, "email", &config.NoIP.Username, "noip.username")
+	godns.MigrateCredential(config, &config.Password, "password", &config.NoIP.Password, "noip.password")
+}
+
 // Handler struct
 type Handler struct {
 	Configuration *godns.Settings
+	client        *dyndns2.Client
 }
 
 // SetConfiguration pass dns settings and store it to handler instance
 func (handler *Handler) SetConfiguration(conf *godns.Settings) {
 	handler.Configuration = conf
+	handler.client = dyndns2.NewClient(NoIPUrl, conf.NoIP.Username, conf.NoIP.Password, godns.GetHttpClient(conf, conf.UseProxy))
+	handler.client.UserAgent = conf.UserAgent
+	handler.client.IPv6Param = "myipv6"
 }
 
 // DomainLoop the main logic loop
 func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
 	defer func() {
 		if err := recover(); err != nil {
-			log.Printf("Recovered in %v: %v\n", err, debug.Stack())
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
 			panicChan <- *domain
 		}
 	}()
@@ -41,74 +75,55 @@ func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.
 	for {
 		if looping {
 			// Sleep with interval
-			log.Printf("Going to sleep, will start next checking in %d seconds...\r\n", handler.Configuration.Interval)
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
 			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
 		}
 
 		looping = true
-		currentIP, err := godns.GetCurrentIP(handler.Configuration)
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
 
 		if err != nil {
-			log.Println("get_currentIP:", err)
+			logger.Error("get_currentIP:", err)
 			continue
 		}
 
-		log.Println("currentIP is:", currentIP)
-		client := godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
-
-		var ip string
-		if strings.ToUpper(handler.Configuration.IPType) == godns.IPV4 {
-			ip = fmt.Sprintf("myip=%s", currentIP)
-		} else if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
-			ip = fmt.Sprintf("myipv6=%s", currentIP)
-		}
+		logger.Info("currentIP is:", currentIP)
 
 		for _, subDomain := range domain.SubDomains {
 			hostname := subDomain + "." + domain.DomainName
-			lastIP, err := godns.ResolveDNS(hostname, handler.Configuration.Resolver, handler.Configuration.IPType)
-			if err != nil {
-				log.Println(err)
+			if _, suspended := handler.client.Suspended(hostname); suspended {
+				continue
+			}
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, nil, godns.CompareDNS) {
+				continue
+			}
+
+			if err := handler.UpdateIP(hostname, currentIP); err != nil {
+				logger.Error("Failed to update the IP:", err)
 				continue
 			}
 
-			//check against currently known IP, if no change, skip update
-			if currentIP == lastIP {
-				log.Printf("IP is the same as cached one. Skip update.\n")
-			} else {
-				req, _ := http.NewRequest("GET", fmt.Sprintf(
-					NoIPUrl,
-					handler.Configuration.Email,
-					handler.Configuration.Password,
-					hostname,
-					ip), nil)
-
-				if handler.Configuration.UserAgent != "" {
-					req.Header.Add("User-Agent", handler.Configuration.UserAgent)
-				}
-
-				// update IP with HTTP GET request
-				resp, err := client.Do(req)
-				if err != nil {
-					// handle error
-					log.Print("Failed to update sub domain:", subDomain)
-					continue
-				}
-
-				defer resp.Body.Close()
-
-				body, err := ioutil.ReadAll(resp.Body)
-				if err != nil || !strings.Contains(string(body), "good") {
-					log.Println("Failed to update the IP")
-					continue
-				} else {
-					log.Print("IP updated to:", currentIP)
-				}
-
-				// Send notification
-				if err := godns.SendNotify(handler.Configuration, fmt.Sprintf("%s.%s", subDomain, domain.DomainName), currentIP); err != nil {
-					log.Println("Failed to send notification")
-				}
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Error("Failed to send notification")
 			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, nil)
 		}
 	}
 }
+
+// UpdateIP update hostname with current IP
+func (handler *Handler) UpdateIP(hostname, currentIP string) error {
+	if _, err := handler.client.Update(hostname, currentIP); err != nil {
+		return err
+	}
+
+	logger.Info("IP updated to:", currentIP)
+	return nil
+}
+
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	return handler.UpdateIP(subDomain+"."+domain, ip)
+}
@@ -0,0 +1,236 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is how long a call may take when no timeout is configured
+const DefaultTimeout = 30 * time.Second
+
+// restartDelay is the minimum time between two starts of a crashing plugin
+var restartDelay = time.Second
+
+// stderrDrainTimeout is how long the end of the stderr of an exited plugin
+// is waited for, its children may keep it open
+const stderrDrainTimeout = time.Second
+
+// ErrExited is returned when the plugin exits during a call
+var ErrExited = errors.New("plugin exited")
+
+// Client runs a plugin and calls its methods. The plugin is started on the
+// first call, killed when a call times out, and restarted on the next call
+// after it exits.
+type Client struct {
+	Command string
+	Args    []string
+	Config  json.RawMessage
+	Timeout time.Duration
+
+	mu           sync.Mutex
+	cmd          *exec.Cmd
+	stdin        io.WriteCloser
+	responses    chan *Response
+	nextID       int64
+	capabilities *Capabilities
+	startedAt    time.Time
+}
+
+// NewClient creates a client for the plugin command
+func NewClient(command string, args []string, config json.RawMessage, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Client{Command: command, Args: args, Config: config, Timeout: timeout}
+}
+
+// Capabilities returns the capabilities announced by the plugin
+func (c *Client) Capabilities() (*Capabilities, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+	return c.capabilities, nil
+}
+
+// GetRecords returns the records of subDomain with the given type
+func (c *Client) GetRecords(domain, subDomain, recordType string) ([]Record, error) {
+	var result GetRecordsResult
+	err := c.Call(MethodGetRecords, GetRecordsParams{Domain: domain, SubDomain: subDomain, Type: recordType}, &result)
+	return result.Records, err
+}
+
+// SetRecord sets the value of a record
+func (c *Client) SetRecord(record Record) error {
+	return c.Call(MethodSetRecord, SetRecordParams(record), nil)
+}
+
+// Call calls method with params and decodes the result into result. A call
+// failing because the plugin exited is retried once with a new process.
+func (c *Client) Call(method string, params, result interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.callLocked(method, params, result)
+	if err == ErrExited {
+		logger.Warnf("Plugin %s exited, restarting it...", c.Command)
+		err = c.callLocked(method, params, result)
+	}
+	return err
+}
+
+func (c *Client) callLocked(method string, params, result interface{}) error {
+	if err := c.start(); err != nil {
+		return err
+	}
+	return c.roundTrip(method, params, result)
+}
+
+// start launches the plugin when it is not running, and asks its
+// capabilities
+func (c *Client) start() error {
+	if c.cmd != nil {
+		return nil
+	}
+
+	if wait := restartDelay - time.Since(c.startedAt); wait > 0 {
+		time.Sleep(wait)
+	}
+	c.startedAt = time.Now()
+
+	cmd := exec.Command(c.Command, c.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start plugin %s: %s", c.Command, err)
+	}
+
+	responses := make(chan *Response)
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(responses)
+		decoder := json.NewDecoder(stdout)
+		for {
+			resp := new(Response)
+			if err := decoder.Decode(resp); err != nil {
+				if err != io.EOF {
+					logger.Errorf("Plugin %s sent an invalid message: %s", c.Command, err)
+					cmd.Process.Kill()
+				}
+				// Wait closes the stderr pipe, its last lines, such as the
+				// reason of a crash, are logged first
+				select {
+				case <-stderrDone:
+				case <-time.After(stderrDrainTimeout):
+				}
+				cmd.Process.Kill()
+				cmd.Wait()
+				return
+			}
+			responses <- resp
+		}
+	}()
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logger.Infof("[%s] %s", c.Command, scanner.Text())
+		}
+	}()
+
+	c.cmd, c.stdin, c.responses = cmd, stdin, responses
+
+	capabilities := new(Capabilities)
+	if err := c.roundTrip(MethodCapabilities, CapabilitiesParams{Config: c.Config}, capabilities); err != nil {
+		c.stop()
+		return fmt.Errorf("plugin %s handshake failed: %s", c.Command, err)
+	}
+	c.capabilities = capabilities
+	logger.Infof("Plugin %s started, methods: %v", capabilities.Name, capabilities.Methods)
+
+	return nil
+}
+
+// roundTrip sends a single request and waits for its response
+func (c *Client) roundTrip(method string, params, result interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	c.nextID++
+	req := Request{JSONRPC: "2.0", ID: c.nextID, Method: method, Params: raw}
+	line, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err := c.stdin.Write(append(line, '\n')); err != nil {
+		c.stop()
+		return ErrExited
+	}
+
+	timeout := time.NewTimer(c.Timeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case resp, ok := <-c.responses:
+			if !ok {
+				c.stop()
+				return ErrExited
+			}
+			if resp.ID != req.ID {
+				// a late response to a call which already timed out
+				continue
+			}
+			if resp.Error != nil {
+				return resp.Error
+			}
+			if result != nil && len(resp.Result) > 0 {
+				return json.Unmarshal(resp.Result, result)
+			}
+			return nil
+		case <-timeout.C:
+			logger.Warnf("Plugin %s did not answer %s within %s, killing it", c.Command, method, c.Timeout)
+			c.stop()
+			return fmt.Errorf("plugin call %s timed out", method)
+		}
+	}
+}
+
+// Close stops the plugin
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+}
+
+func (c *Client) stop() {
+	if c.cmd == nil {
+		return
+	}
+
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+	// drain the responses until the reader goroutine reaps the process
+	for range c.responses {
+	}
+	c.cmd, c.stdin, c.responses = nil, nil, nil
+}
@@ -0,0 +1,193 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/jmbayu/godns"
+)
+
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.PLUGIN)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.PLUGIN,
+		Description:  "Provider plugins, in any language",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "plugin",
+		Credentials:  godns.PluginSettings{},
+		Validate:     validate,
+		Capabilities: godns.Capabilities{IPv6: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.Plugin.Command == "" {
+		return errors.New("plugin command cannot be empty")
+	}
+	return nil
+}
+
+// Handler struct
+type Handler struct {
+	Configuration *godns.Settings
+	client        *Client
+}
+
+// SetConfiguration pass dns settings and store it to handler instance
+func (handler *Handler) SetConfiguration(conf *godns.Settings) {
+	handler.Configuration = conf
+	handler.client = NewClient(conf.Plugin.Command, conf.Plugin.Args, conf.Plugin.Config,
+		time.Second*time.Duration(conf.Plugin.Timeout))
+}
+
+// DomainLoop the main logic loop
+func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
+			panicChan <- *domain
+		}
+	}()
+
+	looping := false
+	for {
+		if looping {
+			// Sleep with interval
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
+			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
+		}
+		looping = true
+
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
+		if err != nil {
+			logger.Error("get_currentIP:", err)
+			continue
+		}
+		logger.Info("currentIP is:", currentIP)
+
+		capabilities, err := handler.client.Capabilities()
+		if err != nil {
+			logger.Error("Failed to start the plugin:", err)
+			continue
+		}
+
+		for _, subDomain := range domain.SubDomains {
+			hostname := subDomain + "." + domain.DomainName
+
+			var providerValue godns.ReadBackFunc
+			if capabilities.Supports(MethodGetRecords) {
+				providerValue = handler.readBack(domain.DomainName, subDomain)
+			}
+
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, providerValue, godns.CompareDNS) {
+				continue
+			}
+
+			logger.Infof("%s Start to update record IP...", hostname)
+			if err := handler.UpdateIP(domain.DomainName, subDomain, currentIP); err != nil {
+				logger.Error("Failed to update IP:", err)
+				continue
+			}
+
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Error("Failed to send notification")
+			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, providerValue)
+		}
+	}
+}
+
+// UpdateIP asks the plugin to set subdomain to currentIP
+func (handler *Handler) UpdateIP(domain, subDomain, currentIP string) error {
+	err := handler.client.SetRecord(Record{
+		Domain:    domain,
+		SubDomain: subDomain,
+		Type:      handler.recordType(),
+		Value:     currentIP,
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Record updated: %s.%s %s", subDomain, domain, currentIP)
+	return nil
+}
+
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	return handler.UpdateIP(domain, subDomain, ip)
+}
+
+// CheckAuth starts the plugin, which checks its config in the handshake
+func (handler *Handler) CheckAuth() error {
+	_, err := handler.client.Capabilities()
+	return err
+}
+
+// CheckRecord reads the record of subDomain through the plugin
+func (handler *Handler) CheckRecord(domain, subDomain string) error {
+	capabilities, err := handler.client.Capabilities()
+	if err != nil {
+		return err
+	}
+	if !capabilities.Supports(MethodGetRecords) {
+		return godns.ErrNotSupported
+	}
+
+	_, err = handler.readBack(domain, subDomain)()
+	return err
+}
+
+// GetRecords reads the records of subDomain of all types through the plugin
+func (handler *Handler) GetRecords(domain, subDomain string) ([]godns.Record, error) {
+	capabilities, err := handler.client.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	if !capabilities.Supports(MethodGetRecords) {
+		return nil, godns.ErrNotSupported
+	}
+
+	list, err := handler.client.GetRecords(domain, subDomain, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var records []godns.Record
+	for _, rec := range list {
+		records = append(records, godns.Record{Name: rec.SubDomain + "." + rec.Domain, Type: rec.Type, Value: rec.Value, TTL: rec.TTL})
+	}
+	return records, nil
+}
+
+// readBack reads the value of subdomain through the plugin
+func (handler *Handler) readBack(domain, subDomain string) godns.ReadBackFunc {
+	return func() (string, error) {
+		records, err := handler.client.GetRecords(domain, subDomain, handler.recordType())
+		if err != nil {
+			return "", err
+		}
+		if len(records) == 0 {
+			return "", errors.New("record not found")
+		}
+		if len(records) > 1 {
+			return "", fmt.Errorf("%d records found", len(records))
+		}
+		return records[0].Value, nil
+	}
+}
+
+func (handler *Handler) recordType() string {
+	if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
+		return "AAAA"
+	}
+	return "A"
+}
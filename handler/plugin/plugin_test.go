@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmbayu/godns"
+)
+
+// pluginCommand returns the plugin under test: the one named by
+// TEST_GODNS_PLUGIN, so the conformance tests can run against any plugin, or the
+// reference plugin built from source
+func pluginCommand(t *testing.T) string {
+	if command := os.Getenv("TEST_GODNS_PLUGIN"); command != "" {
+		return command
+	}
+
+	dir, err := ioutil.TempDir("", "godns-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	command := filepath.Join(dir, "godns-plugin-example")
+	out, err := exec.Command("go", "build", "-o", command, "../../cmd/godns-plugin-example").CombinedOutput()
+	if err != nil {
+		t.Skipf("cannot build the reference plugin: %s %s", err, out)
+	}
+	return command
+}
+
+func TestConformance(t *testing.T) {
+	command := pluginCommand(t)
+	if os.Getenv("TEST_GODNS_PLUGIN") == "" {
+		defer os.RemoveAll(filepath.Dir(command))
+	}
+
+	client := NewClient(command, nil, nil, 10*time.Second)
+	defer client.Close()
+
+	capabilities, err := client.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capabilities.Name == "" {
+		t.Error("capabilities should contain the name of the plugin")
+	}
+	if !capabilities.Supports(MethodSetRecord) {
+		t.Fatal("plugins must support set_record")
+	}
+
+	record := Record{Domain: "example.com", SubDomain: "godns-conformance", Type: "A", Value: "192.0.2.1"}
+	if err := client.SetRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	record.Value = "192.0.2.2"
+	if err := client.SetRecord(record); err != nil {
+		t.Fatal(err)
+	}
+
+	if capabilities.Supports(MethodGetRecords) {
+		records, err := client.GetRecords("example.com", "godns-conformance", "A")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 || records[0].Value != "192.0.2.2" {
+			t.Errorf("get_records should return the record set last, got %v", records)
+		}
+
+		records, err = client.GetRecords("example.com", "godns-conformance", "AAAA")
+		if err != nil || len(records) != 0 {
+			t.Errorf("get_records should return no record for another type, got %v (%v)", records, err)
+		}
+	}
+
+	err = client.Call("no_such_method", struct{}{}, nil)
+	if rpcErr, ok := err.(*Error); !ok || rpcErr.Code != CodeMethodNotFound {
+		t.Errorf("unknown methods should fail with code %d, got %v", CodeMethodNotFound, err)
+	}
+}
+
+func helperClient(t *testing.T, mode string) *Client {
+	restartDelay = 0
+	os.Setenv("TEST_GODNS_HELPER", mode)
+	return NewClient(os.Args[0], []string{"-test.run=TestHelperProcess"}, nil, time.Second)
+}
+
+func TestClientTimeout(t *testing.T) {
+	client := helperClient(t, "hang")
+	defer os.Unsetenv("TEST_GODNS_HELPER")
+	defer client.Close()
+
+	if _, err := client.GetRecords("example.com", "www", "A"); err == nil {
+		t.Fatal("a call without answer should time out")
+	}
+	// the hanging plugin is killed, and a new one answers
+	if _, err := client.Capabilities(); err != nil {
+		t.Errorf("plugin should be restarted after a timeout: %s", err)
+	}
+}
+
+func TestClientRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godns-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("TEST_GODNS_PLUGIN_MARK", filepath.Join(dir, "crashed"))
+
+	logPath := filepath.Join(dir, "godns.log")
+	if err := godns.SetupLogger(&godns.Settings{LogPath: logPath}); err != nil {
+		t.Fatal(err)
+	}
+	defer godns.SetupLogger(&godns.Settings{})
+
+	client := helperClient(t, "crash")
+	defer os.Unsetenv("TEST_GODNS_HELPER")
+	defer client.Close()
+
+	if err := client.SetRecord(Record{Domain: "example.com", SubDomain: "www", Type: "A", Value: "192.0.2.1"}); err != nil {
+		t.Errorf("call should be retried on a restarted plugin: %s", err)
+	}
+
+	logs, _ := ioutil.ReadFile(logPath)
+	if !strings.Contains(string(logs), "panic: helper crashed") {
+		t.Errorf("the stderr of the crashed plugin should be logged, got:\n%s", logs)
+	}
+}
+
+// TestHelperProcess is not a real test, it is run as a misbehaving plugin
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("TEST_GODNS_HELPER")
+	if mode == "" {
+		return
+	}
+	defer os.Exit(0)
+
+	out := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req Request
+		json.Unmarshal(scanner.Bytes(), &req)
+		resp := Response{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage("{}")}
+
+		switch {
+		case req.Method == MethodCapabilities:
+			resp.Result = json.RawMessage(`{"name": "helper", "methods": ["get_records", "set_record"]}`)
+		case mode == "hang":
+			time.Sleep(time.Minute)
+		case mode == "crash":
+			mark := os.Getenv("TEST_GODNS_PLUGIN_MARK")
+			if _, err := os.Stat(mark); os.IsNotExist(err) {
+				ioutil.WriteFile(mark, nil, 0600)
+				fmt.Fprintln(os.Stderr, "panic: helper crashed")
+				os.Exit(1)
+			}
+		}
+		out.Encode(resp)
+	}
+}
@@ -0,0 +1,98 @@
+package plugin
+
+import "encoding/json"
+
+// Plugins are executables exchanging JSON-RPC 2.0 messages with GoDNS over
+// stdin and stdout, one message per line. Anything written to stderr is
+// logged by GoDNS.
+
+const (
+	// MethodCapabilities is the first call after the plugin is started, its
+	// params carry the config of the plugin
+	MethodCapabilities = "capabilities"
+	// MethodGetRecords reads the records of a subdomain
+	MethodGetRecords = "get_records"
+	// MethodSetRecord sets the value of a record
+	MethodSetRecord = "set_record"
+)
+
+// Error codes defined by JSON-RPC 2.0
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Request is a call sent to the plugin
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is the reply of the plugin to a Request with the same ID
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is returned by the plugin when a call fails
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// CapabilitiesParams are the params of the capabilities call
+type CapabilitiesParams struct {
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// Capabilities is the result of the capabilities call
+type Capabilities struct {
+	Name    string   `json:"name"`
+	Methods []string `json:"methods"`
+}
+
+// Supports reports whether the plugin implements method
+func (c *Capabilities) Supports(method string) bool {
+	for _, m := range c.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRecordsParams are the params of the get_records call
+type GetRecordsParams struct {
+	Domain    string `json:"domain"`
+	SubDomain string `json:"sub_domain"`
+	Type      string `json:"type"`
+}
+
+// GetRecordsResult is the result of the get_records call
+type GetRecordsResult struct {
+	Records []Record `json:"records"`
+}
+
+// Record is a DNS record managed by a plugin
+type Record struct {
+	Domain    string `json:"domain"`
+	SubDomain string `json:"sub_domain"`
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	TTL       int    `json:"ttl,omitempty"`
+}
+
+// SetRecordParams are the params of the set_record call, the result is
+// ignored
+type SetRecordParams Record
@@ -0,0 +1,9 @@
+//go:build !no_alidns
+// +build !no_alidns
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/alidns"
+)
@@ -0,0 +1,9 @@
+//go:build !no_cloudflare
+// +build !no_cloudflare
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/cloudflare"
+)
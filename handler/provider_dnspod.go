@@ -0,0 +1,9 @@
+//go:build !no_dnspod
+// +build !no_dnspod
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/dnspod"
+)
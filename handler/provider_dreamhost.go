@@ -0,0 +1,9 @@
+//go:build !no_dreamhost
+// +build !no_dreamhost
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/dreamhost"
+)
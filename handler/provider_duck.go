@@ -0,0 +1,9 @@
+//go:build !no_duck
+// +build !no_duck
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/duck"
+)
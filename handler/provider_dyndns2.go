@@ -0,0 +1,9 @@
+//go:build !no_dyndns2
+// +build !no_dyndns2
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/dyndns2"
+)
@@ -0,0 +1,9 @@
+//go:build !no_google
+// +build !no_google
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/google"
+)
@@ -0,0 +1,9 @@
+//go:build !no_he
+// +build !no_he
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/he"
+)
@@ -0,0 +1,9 @@
+//go:build !no_noip
+// +build !no_noip
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/noip"
+)
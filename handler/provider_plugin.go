@@ -0,0 +1,9 @@
+//go:build !no_plugin
+// +build !no_plugin
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/plugin"
+)
@@ -0,0 +1,9 @@
+//go:build !no_rfc2136
+// +build !no_rfc2136
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/rfc2136"
+)
@@ -0,0 +1,9 @@
+//go:build !no_webhook
+// +build !no_webhook
+
+package handler
+
+import (
+	// register the provider
+	_ "github.com/jmbayu/godns/handler/webhook"
+)
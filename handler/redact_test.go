@@ -0,0 +1,192 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmbayu/godns"
+	"github.com/jmbayu/godns/handler"
+)
+
+// echoTransport answers every request with an error echoing the request,
+// as the worst provider would, or fails it when fail is set, and keeps the
+// requests
+type echoTransport struct {
+	mu   sync.Mutex
+	dump bytes.Buffer
+	fail bool
+}
+
+func (t *echoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	dump, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.dump.Write(dump)
+	fail := t.fail
+	t.mu.Unlock()
+	if fail {
+		// the client adds the URL to the error
+		return nil, errors.New("connection reset")
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusUnauthorized,
+		Status:     "401 Unauthorized",
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(fmt.Sprintf(`{"error": %q}`, dump))),
+		Request:    req,
+	}, nil
+}
+
+func (t *echoTransport) requests() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dump.String()
+}
+
+// sent reports whether secret was sent, as it is, escaped or in the
+// credentials of an Authorization header
+func (t *echoTransport) sent(secret string) bool {
+	for _, form := range []string{secret, url.QueryEscape(secret), url.PathEscape(secret)} {
+		if strings.Contains(t.requests(), form) {
+			return true
+		}
+	}
+	for _, credentials := range t.basicAuth() {
+		decoded, _ := base64.StdEncoding.DecodeString(credentials)
+		if strings.Contains(string(decoded), secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// basicAuth returns the credentials of the Authorization headers sent
+func (t *echoTransport) basicAuth() []string {
+	var list []string
+	for _, line := range strings.Split(t.requests(), "\r\n") {
+		if strings.HasPrefix(line, "Authorization: Basic ") {
+			list = append(list, strings.TrimPrefix(line, "Authorization: Basic "))
+		}
+	}
+	return list
+}
+
+func TestSecretsAreRedacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godns-redact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "godns.log")
+	if err := godns.SetupLogger(&godns.Settings{LogPath: logPath, LogLevel: "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	defer godns.SetupLogger(&godns.Settings{})
+
+	transport := &echoTransport{}
+	defer func(rt http.RoundTripper) { http.DefaultTransport = rt }(http.DefaultTransport)
+	http.DefaultTransport = transport
+
+	rfcSecret := base64.StdEncoding.EncodeToString([]byte("tsig-secret-value"))
+	cases := []struct {
+		settings godns.Settings
+		secrets  []string
+		// sent is false when the secrets never go over HTTP, such as the
+		// AliDNS one signing the requests
+		sent bool
+	}{
+		{godns.Settings{Provider: godns.ALIDNS, AliDNS: godns.AliDNSSettings{AccessKeyID: "key-id", AccessKeySecret: "alidns+secret/value"}}, []string{"alidns+secret/value"}, false},
+		{godns.Settings{Provider: godns.CLOUDFLARE, Cloudflare: godns.CloudflareSettings{APIToken: "cf-token-value"}}, []string{"cf-token-value"}, true},
+		{godns.Settings{Provider: godns.CLOUDFLARE, Cloudflare: godns.CloudflareSettings{Email: "me@example.com", APIKey: "cf-global-key"}}, []string{"cf-global-key"}, true},
+		{godns.Settings{Provider: godns.DNSPOD, DNSPod: godns.DNSPodSettings{LoginToken: "12345,dnspod-token"}}, []string{"12345,dnspod-token"}, true},
+		{godns.Settings{Provider: godns.DREAMHOST, Dreamhost: godns.DreamhostSettings{APIKey: "dreamhost-key"}}, []string{"dreamhost-key"}, true},
+		{godns.Settings{Provider: godns.DUCK, DuckDNS: godns.DuckDNSSettings{Token: "duck-token-value"}}, []string{"duck-token-value"}, true},
+		{godns.Settings{Provider: godns.DYNDNS2, DynDNS2: godns.DynDNS2Settings{URL: "https://members.example.net/nic/update", Username: "router", Password: "dyndns2 pass&word"}}, []string{"dyndns2 pass&word"}, true},
+		{godns.Settings{Provider: godns.GOOGLE, Google: godns.GoogleSettings{Username: "google-user", Password: "google:pass@word"}}, []string{"google:pass@word"}, true},
+		{godns.Settings{Provider: godns.HE, HE: godns.HESettings{DDNSKey: "he-ddns-key"}}, []string{"he-ddns-key"}, true},
+		{godns.Settings{Provider: godns.NOIP, NoIP: godns.NoIPSettings{Username: "noip-user", Password: "noip/pass word"}}, []string{"noip/pass word"}, true},
+		{godns.Settings{Provider: godns.RFC2136, RFC2136: godns.RFC2136Settings{Server: "127.0.0.1:1", Zone: "example.com", KeyName: "godns.", Secret: rfcSecret}}, []string{rfcSecret}, false},
+		{godns.Settings{Provider: godns.WEBHOOK, Webhook: godns.WebhookSettings{URL: "https://api.example.net/update", SecretHeaders: map[string]string{"Authorization": "Bearer webhook-token"}}}, []string{"Bearer webhook-token"}, true},
+	}
+
+	// the plugins get their secrets from their own config
+	covered := map[string]bool{godns.PLUGIN: true}
+	for _, c := range cases {
+		covered[c.settings.Provider] = true
+
+		settings := c.settings
+		settings.IPType = godns.IPV4
+		settings.Domains = []godns.Domain{{DomainName: "example.com", SubDomains: []string{"www"}}}
+		settings.Notify.Telegram = godns.TelegramNotify{Enabled: true, BotApiKey: "123456:telegram-bot-key", ChatId: "42"}
+		godns.RegisterSecrets(&settings)
+
+		h := handler.CreateHandler(settings.Provider)
+		h.SetConfiguration(&settings)
+
+		// the errors are checked as returned, the callers print them
+		// without redacting them again
+		var errs []error
+		for _, fail := range []bool{false, true} {
+			transport.mu.Lock()
+			transport.fail = fail
+			transport.mu.Unlock()
+
+			if setter, ok := h.(handler.IRecordSetter); ok {
+				errs = append(errs, setter.SetRecord("example.com", "www", "203.0.113.7"))
+			}
+			if checker, ok := h.(handler.IChecker); ok {
+				errs = append(errs, checker.CheckAuth())
+			}
+			if lister, ok := h.(handler.IRecordLister); ok {
+				_, err := lister.ListZones()
+				errs = append(errs, err)
+			}
+			errs = append(errs, godns.SendTelegramNotify(&settings, "www.example.com", "203.0.113.7"))
+		}
+		transport.mu.Lock()
+		transport.fail = false
+		transport.mu.Unlock()
+
+		logs, err := ioutil.ReadFile(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range append(c.secrets, settings.Notify.Telegram.BotApiKey) {
+			if c.sent && !transport.sent(secret) {
+				t.Errorf("%s: the secret was not sent, the test does not cover it", settings.Provider)
+			}
+			forms := append([]string{secret, url.QueryEscape(secret), url.PathEscape(secret)}, transport.basicAuth()...)
+			for _, form := range forms {
+				if strings.Contains(string(logs), form) {
+					t.Errorf("%s: %q leaked in the logs", settings.Provider, form)
+				}
+				for _, err := range errs {
+					if err != nil && strings.Contains(err.Error(), form) {
+						t.Errorf("%s: %q leaked in the error %q", settings.Provider, form, err)
+					}
+				}
+			}
+		}
+	}
+
+	for _, name := range godns.ProviderNames() {
+		if !covered[name] {
+			t.Errorf("no redaction test for provider %s", name)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package rfc2136
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/jmbayu/godns"
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultTTL is the TTL of the records when none is configured
+	DefaultTTL = 300
+	// fudge is the allowed clock skew of the TSIG signature, in seconds
+	fudge = 300
+)
+
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.RFC2136)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.RFC2136,
+		Description:  "Any RFC 2136 compliant server, such as BIND, Knot or PowerDNS",
+		URL:          "https://tools.ietf.org/html/rfc2136",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "rfc2136",
+		Credentials:  godns.RFC2136Settings{},
+		Validate:     validate,
+		Capabilities: godns.Capabilities{IPv6: true, CreateRecords: true, TTL: true, Membership: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.RFC2136.Server == "" {
+		return errors.New("rfc2136 server cannot be empty")
+	}
+	if (config.RFC2136.KeyName == "") != (config.RFC2136.Secret == "") {
+		return errors.New("rfc2136 key name and secret must be set together")
+	}
+	if _, err := base64.StdEncoding.DecodeString(config.RFC2136.Secret); err != nil {
+		return errors.New("rfc2136 secret must be base64 encoded")
+	}
+	// a misspelt algorithm would only show as BADSIG from the server
+	if name := config.RFC2136.Algorithm; name != "" {
+		if _, ok := algorithms[strings.TrimSuffix(strings.ToLower(name), ".")]; !ok {
+			return fmt.Errorf("unknown rfc2136 algorithm %q, must be hmac-md5, hmac-sha1, hmac-sha224, hmac-sha256, hmac-sha384 or hmac-sha512", name)
+		}
+	}
+	return nil
+}
+
+// Handler struct
+type Handler struct {
+	Configuration *godns.Settings
+}
+
+// SetConfiguration pass dns settings and store it to handler instance
+func (handler *Handler) SetConfiguration(conf *godns.Settings) {
+	handler.Configuration = conf
+}
+
+// DomainLoop the main logic loop
+func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
+			panicChan <- *domain
+		}
+	}()
+
+	looping := false
+	for {
+		if looping {
+			// Sleep with interval
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
+			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
+		}
+		looping = true
+
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
+		if err != nil {
+			logger.Error("get_currentIP:", err)
+			continue
+		}
+		logger.Info("currentIP is:", currentIP)
+
+		for _, subDomain := range domain.SubDomains {
+			if domain.IsMember(subDomain) {
+				if err := godns.UpdateMember(handler.Configuration, handler, domain, subDomain, currentIP); err != nil {
+					logger.Error("Failed to update the membership of", subDomain+":", err)
+				}
+				continue
+			}
+
+			hostname := subDomain + "." + domain.DomainName
+			providerValue := func() (string, error) {
+				return handler.Query(hostname)
+			}
+
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, providerValue, godns.CompareDNS) {
+				continue
+			}
+
+			// the old address is needed to clean up its PTR record
+			lastIP, _ := handler.Query(hostname)
+
+			logger.Infof("%s Start to update record IP...", hostname)
+			if err := handler.UpdateIP(domain.DomainName, subDomain, currentIP, lastIP); err != nil {
+				logger.Error("Failed to update IP:", err)
+				continue
+			}
+
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Error("Failed to send notification")
+			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, providerValue)
+		}
+	}
+}
+
+// UpdateIP replaces the address RRset of subDomain with currentIP, and the
+// matching PTR record when enabled
+func (handler *Handler) UpdateIP(domain, subDomain, currentIP, lastIP string) error {
+	conf := handler.Configuration.RFC2136
+	hostname := dns.Fqdn(subDomain + "." + domain)
+
+	zone := conf.Zone
+	if zone == "" {
+		zone = domain
+	}
+
+	rr, err := handler.addressRecord(hostname, currentIP)
+	if err != nil {
+		return err
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	m.RemoveRRset([]dns.RR{rr})
+	m.Insert([]dns.RR{rr})
+	if err := handler.exchange(m); err != nil {
+		return err
+	}
+	logger.Infof("Record updated: %s %s", hostname, currentIP)
+
+	if !conf.UpdatePTR {
+		return nil
+	}
+
+	if lastIP != "" && lastIP != currentIP {
+		if err := handler.updatePTR(hostname, lastIP, false); err != nil {
+			logger.Error("Failed to remove old PTR record:", err)
+		}
+	}
+
+	return handler.updatePTR(hostname, currentIP, true)
+}
+
+// ListMembers returns the addresses of subDomain, of the type of ip_type
+func (handler *Handler) ListMembers(domain, subDomain string) ([]string, error) {
+	records, err := handler.GetRecords(domain, subDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []string
+	for _, record := range records {
+		if record.Type == dns.TypeToString[handler.recordType()] {
+			members = append(members, record.Value)
+		}
+	}
+	return members, nil
+}
+
+// AddMember adds ip to the address RRset of subDomain, and its PTR record
+// when enabled
+func (handler *Handler) AddMember(domain, subDomain, ip string) error {
+	return handler.updateMember(domain, subDomain, ip, true)
+}
+
+// RemoveMember removes ip from the address RRset of subDomain, and its PTR
+// record when enabled
+func (handler *Handler) RemoveMember(domain, subDomain, ip string) error {
+	return handler.updateMember(domain, subDomain, ip, false)
+}
+
+func (handler *Handler) updateMember(domain, subDomain, ip string, add bool) error {
+	hostname := dns.Fqdn(subDomain + "." + domain)
+	zone := handler.Configuration.RFC2136.Zone
+	if zone == "" {
+		zone = domain
+	}
+
+	rr, err := handler.addressRecord(hostname, ip)
+	if err != nil {
+		return err
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	if add {
+		m.Insert([]dns.RR{rr})
+	} else {
+		m.Remove([]dns.RR{rr})
+	}
+	if err := handler.exchange(m); err != nil {
+		return err
+	}
+
+	if handler.Configuration.RFC2136.UpdatePTR {
+		return handler.updatePTR(hostname, ip, add)
+	}
+	return nil
+}
+
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	lastIP, _ := handler.Query(subDomain + "." + domain)
+	return handler.UpdateIP(domain, subDomain, ip, lastIP)
+}
+
+// CheckAuth asks the server for the zone of the first domain, the key can
+// only be checked by an update
+func (handler *Handler) CheckAuth() error {
+	zone := handler.Configuration.RFC2136.Zone
+	if zone == "" && len(handler.Configuration.Domains) > 0 {
+		zone = handler.Configuration.Domains[0].DomainName
+	}
+	if zone == "" {
+		return nil
+	}
+
+	_, err := handler.findZone(dns.Fqdn(zone))
+	return err
+}
+
+// CheckRecord checks that the server has the record of subDomain
+func (handler *Handler) CheckRecord(domain, subDomain string) error {
+	_, err := handler.Query(subDomain + "." + domain)
+	return err
+}
+
+// Query reads the address of hostname directly from the server
+func (handler *Handler) Query(hostname string) (string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(hostname), handler.recordType())
+
+	in, _, err := new(dns.Client).Exchange(m, handler.server())
+	if err != nil {
+		return "", err
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		return "", errors.New(dns.RcodeToString[in.Rcode])
+	}
+
+	for _, rr := range in.Answer {
+		switch t := rr.(type) {
+		case *dns.A:
+			return t.A.String(), nil
+		case *dns.AAAA:
+			return t.AAAA.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no address found for %s", hostname)
+}
+
+// GetRecords reads the A and AAAA records of subDomain from the server
+func (handler *Handler) GetRecords(domain, subDomain string) ([]godns.Record, error) {
+	hostname := subDomain + "." + domain
+	var records []godns.Record
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		m := new(dns.Msg)
+		m.SetQuestion(dns.Fqdn(hostname), qtype)
+
+		in, _, err := new(dns.Client).Exchange(m, handler.server())
+		if err != nil {
+			return nil, err
+		}
+		if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+			return nil, errors.New(dns.RcodeToString[in.Rcode])
+		}
+
+		for _, rr := range in.Answer {
+			record := godns.Record{Name: hostname, Type: dns.TypeToString[rr.Header().Rrtype], TTL: int(rr.Header().Ttl)}
+			switch t := rr.(type) {
+			case *dns.A:
+				record.Value = t.A.String()
+			case *dns.AAAA:
+				record.Value = t.AAAA.String()
+			default:
+				continue
+			}
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// updatePTR adds or removes the PTR record of ip pointing to hostname
+func (handler *Handler) updatePTR(hostname, ip string, add bool) error {
+	reverse, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return err
+	}
+
+	zone := handler.Configuration.RFC2136.PTRZone
+	if zone == "" {
+		if zone, err = handler.findZone(reverse); err != nil {
+			return err
+		}
+	}
+
+	ptr := &dns.PTR{
+		Hdr: dns.RR_Header{Name: reverse, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: handler.ttl()},
+		Ptr: hostname,
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	if add {
+		m.RemoveRRset([]dns.RR{ptr})
+		m.Insert([]dns.RR{ptr})
+	} else {
+		m.Remove([]dns.RR{ptr})
+	}
+
+	if err := handler.exchange(m); err != nil {
+		return err
+	}
+	logger.Infof("PTR record updated: %s %s", reverse, hostname)
+	return nil
+}
+
+// findZone asks the server for the zone enclosing name
+func (handler *Handler) findZone(name string) (string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, dns.TypeSOA)
+
+	in, _, err := new(dns.Client).Exchange(m, handler.server())
+	if err != nil {
+		return "", err
+	}
+
+	for _, rr := range append(in.Answer, in.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Hdr.Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot find the zone of %s, please set ptr_zone", name)
+}
+
+// exchange signs m when a key is configured and sends it to the server
+func (handler *Handler) exchange(m *dns.Msg) error {
+	conf := handler.Configuration.RFC2136
+	client := new(dns.Client)
+
+	if conf.KeyName != "" {
+		keyName := dns.Fqdn(conf.KeyName)
+		client.TsigSecret = map[string]string{keyName: conf.Secret}
+		m.SetTsig(keyName, Algorithm(conf.Algorithm), fudge, time.Now().Unix())
+	}
+
+	in, _, err := client.Exchange(m, handler.server())
+	if err != nil {
+		return err
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("update refused by server: %s", dns.RcodeToString[in.Rcode])
+	}
+
+	return nil
+}
+
+func (handler *Handler) addressRecord(hostname, ip string) (dns.RR, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+
+	hdr := dns.RR_Header{Name: hostname, Rrtype: handler.recordType(), Class: dns.ClassINET, Ttl: handler.ttl()}
+	if handler.recordType() == dns.TypeAAAA {
+		return &dns.AAAA{Hdr: hdr, AAAA: addr}, nil
+	}
+	return &dns.A{Hdr: hdr, A: addr}, nil
+}
+
+func (handler *Handler) recordType() uint16 {
+	if strings.ToUpper(handler.Configuration.IPType) == godns.IPV6 {
+		return dns.TypeAAAA
+	}
+	return dns.TypeA
+}
+
+func (handler *Handler) ttl() uint32 {
+	if handler.Configuration.RFC2136.TTL > 0 {
+		return uint32(handler.Configuration.RFC2136.TTL)
+	}
+	return DefaultTTL
+}
+
+func (handler *Handler) server() string {
+	server := handler.Configuration.RFC2136.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		return net.JoinHostPort(server, "53")
+	}
+	return server
+}
+
+// algorithms are the TSIG algorithms by their name in the settings
+var algorithms = map[string]string{
+	"hmac-md5":                 dns.HmacMD5,
+	"hmac-md5.sig-alg.reg.int": dns.HmacMD5,
+	"hmac-sha1":                dns.HmacSHA1,
+	"hmac-sha224":              dns.HmacSHA224,
+	"hmac-sha256":              dns.HmacSHA256,
+	"hmac-sha384":              dns.HmacSHA384,
+	"hmac-sha512":              dns.HmacSHA512,
+}
+
+// Algorithm returns the TSIG algorithm for name, HMAC-SHA256 by default.
+// The unknown names are rejected by the validation.
+func Algorithm(name string) string {
+	if algorithm, ok := algorithms[strings.TrimSuffix(strings.ToLower(name), ".")]; ok {
+		return algorithm
+	}
+	return dns.HmacSHA256
+}
@@ -0,0 +1,279 @@
+package rfc2136
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmbayu/godns"
+	"github.com/miekg/dns"
+)
+
+const (
+	testKey    = "godns-key."
+	testSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+)
+
+// testServer is an in-process authoritative server accepting signed updates
+// for example.com. and 2.0.192.in-addr.arpa.
+type testServer struct {
+	sync.Mutex
+	records map[string][]dns.RR
+	server  *dns.Server
+}
+
+func startServer(t *testing.T) *testServer {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := &testServer{records: map[string][]dns.RR{}}
+	started := make(chan struct{})
+	ts.server = &dns.Server{
+		PacketConn:        pc,
+		TsigSecret:        map[string]string{testKey: testSecret},
+		NotifyStartedFunc: func() { close(started) },
+		MsgAcceptFunc:     func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+		Handler:           dns.HandlerFunc(ts.serveDNS),
+	}
+
+	go ts.server.ActivateAndServe()
+	<-started
+
+	return ts
+}
+
+func (ts *testServer) addr() string {
+	return ts.server.PacketConn.LocalAddr().String()
+}
+
+func (ts *testServer) serveDNS(w dns.ResponseWriter, r *dns.Msg) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	q := r.Question[0]
+	switch r.Opcode {
+	case dns.OpcodeUpdate:
+		if r.IsTsig() == nil || w.TsigStatus() != nil {
+			m.Rcode = dns.RcodeNotAuth
+			break
+		}
+		for _, rr := range r.Ns {
+			ts.apply(rr)
+		}
+		m.SetTsig(testKey, dns.HmacSHA256, 300, int64(r.IsTsig().TimeSigned))
+	case dns.OpcodeQuery:
+		if q.Qtype == dns.TypeSOA {
+			zone := "2.0.192.in-addr.arpa."
+			if dns.IsSubDomain("example.com.", q.Name) {
+				zone = "example.com."
+			}
+			soa, _ := dns.NewRR(zone + " 300 IN SOA ns1.example.com. admin.example.com. 1 3600 600 86400 300")
+			m.Ns = append(m.Ns, soa)
+			break
+		}
+		for _, rr := range ts.records[q.Name] {
+			if rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+	}
+
+	w.WriteMsg(m)
+}
+
+func (ts *testServer) get(name string) []dns.RR {
+	ts.Lock()
+	defer ts.Unlock()
+	return ts.records[name]
+}
+
+// apply applies an RR of the update section, see RFC 2136 section 3.4.2
+func (ts *testServer) apply(rr dns.RR) {
+	h := rr.Header()
+	var kept []dns.RR
+	for _, existing := range ts.records[h.Name] {
+		switch h.Class {
+		case dns.ClassANY:
+			if h.Rrtype == dns.TypeANY || existing.Header().Rrtype == h.Rrtype {
+				continue
+			}
+		case dns.ClassNONE:
+			if existing.Header().Rrtype == h.Rrtype && existing.String()[len(existing.Header().String()):] == rr.String()[len(h.String()):] {
+				continue
+			}
+		}
+		kept = append(kept, existing)
+	}
+	if h.Class == dns.ClassINET {
+		kept = append(kept, rr)
+	}
+	ts.records[h.Name] = kept
+}
+
+func newHandler(server string) *Handler {
+	handler := &Handler{}
+	handler.SetConfiguration(&godns.Settings{
+		IPType: godns.IPV4,
+		RFC2136: godns.RFC2136Settings{
+			Server:    server,
+			KeyName:   "godns-key",
+			Algorithm: "hmac-sha256",
+			Secret:    testSecret,
+			TTL:       60,
+			UpdatePTR: true,
+		},
+	})
+	return handler
+}
+
+func TestUpdateIP(t *testing.T) {
+	ts := startServer(t)
+	defer ts.server.Shutdown()
+
+	handler := newHandler(ts.addr())
+	if err := handler.UpdateIP("example.com", "www", "192.0.2.1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.UpdateIP("example.com", "www", "192.0.2.2", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ip, err := handler.Query("www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "192.0.2.2" {
+		t.Errorf("www.example.com should be updated to 192.0.2.2, got %s", ip)
+	}
+	if len(ts.get("www.example.com.")) != 1 {
+		t.Errorf("the A RRset should be replaced, got %v", ts.get("www.example.com."))
+	}
+	if ttl := ts.get("www.example.com.")[0].Header().Ttl; ttl != 60 {
+		t.Errorf("TTL should be 60, got %d", ttl)
+	}
+
+	if len(ts.get("1.2.0.192.in-addr.arpa.")) != 0 {
+		t.Error("PTR record of the old address should be removed")
+	}
+	ptr := ts.get("2.2.0.192.in-addr.arpa.")
+	if len(ptr) != 1 || ptr[0].(*dns.PTR).Ptr != "www.example.com." {
+		t.Errorf("PTR record of the new address should point to www.example.com., got %v", ptr)
+	}
+}
+
+func TestUpdateIPBadKey(t *testing.T) {
+	ts := startServer(t)
+	defer ts.server.Shutdown()
+
+	handler := newHandler(ts.addr())
+	handler.Configuration.RFC2136.Secret = "d3Jvbmctc2VjcmV0"
+	if err := handler.UpdateIP("example.com", "www", "192.0.2.1", ""); err == nil {
+		t.Error("update signed with a wrong secret should fail")
+	}
+	if len(ts.get("www.example.com.")) != 0 {
+		t.Error("records should not be changed by a rejected update")
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	ts := startServer(t)
+	defer ts.server.Shutdown()
+
+	for _, name := range []string{"hmac-md5", "hmac-sha1", "hmac-sha224", "HMAC-SHA384", "hmac-sha512."} {
+		handler := newHandler(ts.addr())
+		handler.Configuration.RFC2136.Algorithm = name
+		if err := validate(handler.Configuration); err != nil {
+			t.Errorf("%s should be valid, got %v", name, err)
+		}
+		if err := handler.UpdateIP("example.com", "www", "192.0.2.1", ""); err != nil {
+			t.Errorf("update signed with %s should succeed, got %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"hmac-sha-256", "sha384", "hmac-sha3"} {
+		handler := newHandler(ts.addr())
+		handler.Configuration.RFC2136.Algorithm = name
+		if err := validate(handler.Configuration); err == nil {
+			t.Errorf("%s should be rejected", name)
+		}
+	}
+}
+
+func TestCheckRecord(t *testing.T) {
+	ts := startServer(t)
+	defer ts.server.Shutdown()
+
+	handler := newHandler(ts.addr())
+	if err := handler.CheckRecord("example.com", "www"); err == nil {
+		t.Error("www.example.com does not exist yet, check should fail")
+	}
+
+	if err := handler.UpdateIP("example.com", "www", "192.0.2.1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.CheckRecord("example.com", "www"); err != nil {
+		t.Errorf("www.example.com exists, check should pass, got %v", err)
+	}
+}
+
+func TestGetRecords(t *testing.T) {
+	ts := startServer(t)
+	defer ts.server.Shutdown()
+
+	handler := newHandler(ts.addr())
+	if err := handler.UpdateIP("example.com", "www", "192.0.2.1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := handler.GetRecords("example.com", "www")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0] != (godns.Record{Name: "www.example.com", Type: "A", Value: "192.0.2.1", TTL: 60}) {
+		t.Errorf("should read the A record of www.example.com, got %+v", records)
+	}
+}
+
+func TestMembership(t *testing.T) {
+	ts := startServer(t)
+	defer ts.server.Shutdown()
+
+	handler := newHandler(ts.addr())
+	handler.Configuration.Domains = []godns.Domain{{DomainName: "example.com", SubDomains: []string{"api"}, Membership: []string{"api"}, WithdrawOnExit: true}}
+	domain := &handler.Configuration.Domains[0]
+
+	// another host of the round-robin record
+	if err := handler.AddMember("example.com", "api", "192.0.2.50"); err != nil {
+		t.Fatal(err)
+	}
+
+	members := func() []string {
+		list, err := handler.ListMembers("example.com", "api")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.2"} {
+		if err := godns.UpdateMember(handler.Configuration, handler, domain, "api", ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(members(), ","); got != "192.0.2.50,192.0.2.2" {
+		t.Errorf("only the address of this host should be replaced, got %s", got)
+	}
+	if len(ts.get("1.2.0.192.in-addr.arpa.")) != 0 {
+		t.Error("PTR record of the previous address should be removed")
+	}
+
+	godns.WithdrawMembers(handler.Configuration, handler)
+	if got := strings.Join(members(), ","); got != "192.0.2.50" {
+		t.Errorf("only the address of this host should be withdrawn, got %s", got)
+	}
+}
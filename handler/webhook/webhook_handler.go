@@ -0,0 +1,301 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jmbayu/godns"
+)
+
+// logger logs with the provider field, and the domain one in DomainLoop
+var logger = godns.ProviderLog(godns.WEBHOOK)
+
+func init() {
+	godns.RegisterProvider(godns.Provider{
+		Name:         godns.WEBHOOK,
+		Description:  "Any HTTP API, described by templates",
+		New:          func() godns.Handler { return &Handler{} },
+		ConfigKey:    "webhook",
+		Credentials:  godns.WebhookSettings{},
+		Validate:     validate,
+		Capabilities: godns.Capabilities{IPv6: true},
+	})
+}
+
+func validate(config *godns.Settings) error {
+	if config.Webhook.URL == "" {
+		return errors.New("webhook url cannot be empty")
+	}
+	if config.Webhook.SuccessRegex != "" {
+		if _, err := regexp.Compile(config.Webhook.SuccessRegex); err != nil {
+			return fmt.Errorf("invalid webhook success_regex: %s", err)
+		}
+	}
+
+	// the templates are parsed again on every update, their errors are
+	// reported now rather than at each interval
+	templates := map[string]string{"url": config.Webhook.URL, "body": config.Webhook.Body}
+	for _, headers := range []map[string]string{config.Webhook.Headers, config.Webhook.SecretHeaders} {
+		for name, value := range headers {
+			templates[name] = value
+		}
+	}
+	var names []string
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := parse(name, templates[name]); err != nil {
+			return fmt.Errorf("webhook %s", err)
+		}
+	}
+	return nil
+}
+
+// Handler struct
+type Handler struct {
+	Configuration *godns.Settings
+}
+
+// Data is passed to the templates of the request
+type Data struct {
+	Hostname  string
+	SubDomain string
+	Domain    string
+	IP        string
+	IPType    string
+}
+
+var funcs = template.FuncMap{
+	// json quotes a value as a JSON string, for request bodies
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// SetConfiguration pass dns settings and store it to handler instance
+func (handler *Handler) SetConfiguration(conf *godns.Settings) {
+	handler.Configuration = conf
+}
+
+// DomainLoop the main logic loop
+func (handler *Handler) DomainLoop(domain *godns.Domain, panicChan chan<- godns.Domain) {
+	logger := logger.WithDomain(domain.DomainName)
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("Recovered in %v: %v", err, debug.Stack())
+			panicChan <- *domain
+		}
+	}()
+
+	looping := false
+	for {
+		if looping {
+			// Sleep with interval
+			logger.Infof("Going to sleep, will start next checking in %d seconds...", handler.Configuration.Interval)
+			time.Sleep(time.Second * time.Duration(handler.Configuration.Interval))
+		}
+		looping = true
+
+		currentIP, err := godns.GetDomainIP(handler.Configuration, domain)
+		if err != nil {
+			logger.Error("get_currentIP:", err)
+			continue
+		}
+		logger.Info("currentIP is:", currentIP)
+
+		for _, subDomain := range domain.SubDomains {
+			hostname := subDomain + "." + domain.DomainName
+			if !godns.NeedsUpdate(handler.Configuration, domain, hostname, currentIP, nil, godns.CompareDNS) {
+				continue
+			}
+
+			logger.Infof("%s Start to update record IP...", hostname)
+			if err := handler.UpdateIP(domain.DomainName, subDomain, currentIP); err != nil {
+				logger.Error("Failed to update IP:", err)
+				continue
+			}
+
+			// Send notification
+			if err := godns.SendNotify(handler.Configuration, hostname, currentIP); err != nil {
+				logger.Error("Failed to send notification")
+			}
+
+			godns.RecordUpdated(handler.Configuration, hostname, currentIP, nil)
+		}
+	}
+}
+
+// UpdateIP sends the configured request for subdomain, and checks the
+// response against the success criteria
+func (handler *Handler) UpdateIP(domain, subDomain, currentIP string) error {
+	conf := handler.Configuration.Webhook
+	data := Data{
+		Hostname:  subDomain + "." + domain,
+		SubDomain: subDomain,
+		Domain:    domain,
+		IP:        currentIP,
+		IPType:    strings.ToUpper(handler.Configuration.IPType),
+	}
+
+	method := conf.Method
+	if method == "" {
+		method = "GET"
+	}
+	url, err := render("url", conf.URL, data)
+	if err != nil {
+		return err
+	}
+	body, err := render("body", conf.Body, data)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(method), url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for _, headers := range []map[string]string{conf.Headers, conf.SecretHeaders} {
+		for name, value := range headers {
+			if value, err = render(name, value, data); err != nil {
+				return err
+			}
+			req.Header.Set(name, value)
+		}
+	}
+
+	client := godns.GetHttpClient(handler.Configuration, handler.Configuration.UseProxy)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := Succeeded(conf, resp.StatusCode, content); err != nil {
+		return err
+	}
+
+	logger.Infof("Record updated: %s %s", data.Hostname, currentIP)
+	return nil
+}
+
+// SetRecord sets subdomain to ip on demand
+func (handler *Handler) SetRecord(domain, subDomain, ip string) error {
+	return handler.UpdateIP(domain, subDomain, ip)
+}
+
+// Succeeded checks a response against every configured success criterion:
+// the status code (any 2xx by default), the body regex and the JSON path.
+// Without success_json_value, the JSON path must hold true.
+func Succeeded(conf godns.WebhookSettings, status int, body []byte) error {
+	if len(conf.SuccessStatus) == 0 {
+		if status < 200 || status > 299 {
+			return fmt.Errorf("unexpected status %d: %s", status, godns.Redact(string(body)))
+		}
+	} else {
+		found := false
+		for _, expected := range conf.SuccessStatus {
+			if status == expected {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unexpected status %d: %s", status, godns.Redact(string(body)))
+		}
+	}
+
+	if conf.SuccessRegex != "" {
+		re, err := regexp.Compile(conf.SuccessRegex)
+		if err != nil {
+			return err
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("response does not match %s: %s", conf.SuccessRegex, godns.Redact(string(body)))
+		}
+	}
+
+	if conf.SuccessJSONPath != "" {
+		value, err := lookupJSON(body, conf.SuccessJSONPath)
+		if err != nil {
+			return err
+		}
+
+		expected := conf.SuccessJSONValue
+		if expected == "" {
+			expected = "true"
+		}
+		if fmt.Sprint(value) != expected {
+			return fmt.Errorf("%s is %v, expected %s", conf.SuccessJSONPath, value, expected)
+		}
+	}
+
+	return nil
+}
+
+// lookupJSON returns the value at path in body, path is a dot separated
+// list of object keys and array indexes, such as result.0.status
+func lookupJSON(body []byte, path string) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("response is not JSON: %s", err)
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[key]; !ok {
+				return nil, fmt.Errorf("%s not found in response", path)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("%s not found in response", path)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("%s not found in response", path)
+		}
+	}
+
+	return value, nil
+}
+
+func parse(name, tplsrc string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(funcs).Parse(tplsrc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %s", name, err)
+	}
+	return t, nil
+}
+
+func render(name, tplsrc string, data Data) (string, error) {
+	t, err := parse(name, tplsrc)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jmbayu/godns"
+)
+
+func TestUpdateIP(t *testing.T) {
+	var method, path, auth, contentType, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, auth, contentType = r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"result": {"status": "ok"}}`))
+	}))
+	defer ts.Close()
+
+	handler := &Handler{}
+	handler.SetConfiguration(&godns.Settings{
+		IPType: "IPv4",
+		Webhook: godns.WebhookSettings{
+			Method:           "put",
+			URL:              ts.URL + "/zones/{{.Domain}}/records/{{.SubDomain}}?type={{if eq .IPType \"IPV6\"}}AAAA{{else}}A{{end}}",
+			Headers:          map[string]string{"Content-Type": "application/json"},
+			SecretHeaders:    map[string]string{"Authorization": "Bearer token"},
+			Body:             `{"name": {{json .Hostname}}, "content": {{json .IP}}}`,
+			SuccessJSONPath:  "result.status",
+			SuccessJSONValue: "ok",
+		},
+	})
+
+	if err := handler.UpdateIP("example.com", "www", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if method != "PUT" || path != "/zones/example.com/records/www?type=A" || auth != "Bearer token" || contentType != "application/json" {
+		t.Errorf("unexpected request %s %s with %q and %q", method, path, auth, contentType)
+	}
+	if body != `{"name": "www.example.com", "content": "192.0.2.1"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+func TestSucceeded(t *testing.T) {
+	cases := []struct {
+		conf   godns.WebhookSettings
+		status int
+		body   string
+		ok     bool
+	}{
+		{godns.WebhookSettings{}, 204, "", true},
+		{godns.WebhookSettings{}, 500, "", false},
+		{godns.WebhookSettings{SuccessStatus: []int{200}}, 201, "", false},
+		{godns.WebhookSettings{SuccessRegex: "^(good|nochg)"}, 200, "nochg 192.0.2.1", true},
+		{godns.WebhookSettings{SuccessRegex: "^(good|nochg)"}, 200, "badauth", false},
+		{godns.WebhookSettings{SuccessJSONPath: "success"}, 200, `{"success": true}`, true},
+		{godns.WebhookSettings{SuccessJSONPath: "success"}, 200, `{"success": false}`, false},
+		{godns.WebhookSettings{SuccessJSONPath: "errors.0.code", SuccessJSONValue: "0"}, 200, `{"errors": [{"code": 0}]}`, true},
+		{godns.WebhookSettings{SuccessJSONPath: "errors.1.code"}, 200, `{"errors": [{"code": 0}]}`, false},
+	}
+
+	for i, c := range cases {
+		if err := Succeeded(c.conf, c.status, []byte(c.body)); (err == nil) != c.ok {
+			t.Errorf("case %d: expected success %v, got %v", i, c.ok, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := godns.WebhookSettings{
+		URL:     "https://api.example.net/{{.Hostname}}",
+		Body:    `{"content": {{json .IP}}}`,
+		Headers: map[string]string{"X-Record": "{{.SubDomain}}"},
+	}
+	if err := validate(&godns.Settings{Webhook: valid}); err != nil {
+		t.Errorf("the templates are valid, got %v", err)
+	}
+
+	cases := []struct {
+		conf godns.WebhookSettings
+		name string
+	}{
+		{godns.WebhookSettings{URL: "https://api.example.net/{{.Hostname}"}, "url"},
+		{godns.WebhookSettings{URL: "https://api.example.net/", Body: "{{json .IP}"}, "body"},
+		{godns.WebhookSettings{URL: "https://api.example.net/", Headers: map[string]string{"X-Record": "{{if .IP}}"}}, "X-Record"},
+		{godns.WebhookSettings{URL: "https://api.example.net/", SecretHeaders: map[string]string{"Authorization": "Bearer {{.Token"}}, "Authorization"},
+		{godns.WebhookSettings{URL: "https://api.example.net/", Body: "{{unknown .IP}}"}, "body"},
+	}
+	for _, c := range cases {
+		err := validate(&godns.Settings{Webhook: c.conf})
+		if err == nil || !strings.Contains(err.Error(), "invalid "+c.name+" template") {
+			t.Errorf("the %s template should be rejected, got %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package godns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// HealthICMP pings the target
+	HealthICMP = "icmp"
+	// HealthTCP connects to the target, a host:port
+	HealthTCP = "tcp"
+	// HealthHTTP gets the target, a URL, and expects a status below 400
+	HealthHTTP = "http"
+
+	// DefaultHealthTimeout is how long a health check may take by default
+	DefaultHealthTimeout = 5 * time.Second
+)
+
+// CheckIPSource returns the IP of the ip_sources entry name, or why its
+// uplink is unusable: the IP lookup failed, or the health check did. The
+// checks are sent from the source address of the entry, so that they go
+// through its uplink.
+func CheckIPSource(configuration *Settings, name string) (string, error) {
+	settings := IPSourceSettings(configuration, name)
+	ip, err := GetCurrentIP(settings)
+	if err != nil {
+		return "", err
+	}
+	if ip == "" {
+		return "", errors.New("no IP found")
+	}
+
+	check := configuration.IPSources[name].HealthCheck
+	timeout := DefaultHealthTimeout
+	if check.Timeout > 0 {
+		timeout = time.Duration(check.Timeout) * time.Second
+	}
+
+	switch strings.ToLower(check.Type) {
+	case "":
+		err = nil
+	case HealthICMP:
+		err = pingCheck(settings, check.Target, timeout)
+	case HealthTCP:
+		err = tcpCheck(settings, check.Target, timeout)
+	case HealthHTTP:
+		err = httpCheck(settings, check.Target, timeout)
+	default:
+		err = fmt.Errorf("unknown health check %q", check.Type)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s health check of %s failed: %s", check.Type, check.Target, err)
+	}
+	return ip, nil
+}
+
+func tcpCheck(settings *Settings, target string, timeout time.Duration) error {
+	dialer, err := newSourceDialer(settings.HTTP, settings.IPType, timeout)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func httpCheck(settings *Settings, target string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := GetHttpClient(settings, false).Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// pingCheck sends an ICMP echo to target and waits for the reply. It needs
+// raw sockets, or unprivileged ping sockets on Linux, see
+// net.ipv4.ping_group_range.
+func pingCheck(settings *Settings, target string, timeout time.Duration) error {
+	addr, err := net.ResolveIPAddr("ip", target)
+	if err != nil {
+		return err
+	}
+	isIPv6 := addr.IP.To4() == nil
+
+	local := settings.HTTP.SourceIP
+	if settings.HTTP.SourceInterface != "" {
+		ip, err := interfaceAddress(settings.HTTP.SourceInterface, isIPv6)
+		if err != nil {
+			return err
+		}
+		local = ip.String()
+	}
+
+	network, unprivileged, protocol := "ip4:icmp", "udp4", 1
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if isIPv6 {
+		network, unprivileged, protocol = "ip6:ipv6-icmp", "udp6", 58
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	var dst net.Addr = addr
+	conn, err := icmp.ListenPacket(network, local)
+	if err != nil {
+		if conn, err = icmp.ListenPacket(unprivileged, local); err != nil {
+			return err
+		}
+		dst = &net.UDPAddr{IP: addr.IP, Zone: addr.Zone}
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	seq := int(time.Now().UnixNano() & 0xffff)
+	msg := icmp.Message{Type: echoType, Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: seq, Data: []byte("GoDNS")}}
+	packet, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(packet, dst); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		reply, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		// the ID of the unprivileged sockets is set by the kernel
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq {
+			return nil
+		}
+	}
+}
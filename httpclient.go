@@ -0,0 +1,302 @@
+package godns
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// DefaultHTTPTimeout is how long a request may take by default
+	DefaultHTTPTimeout = 30 * time.Second
+	// DefaultConnectTimeout is how long connecting may take by default
+	DefaultConnectTimeout = 10 * time.Second
+	// DefaultUserAgent is sent when neither user_agent nor the handler set one
+	DefaultUserAgent = "GoDNS"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// clientKey holds what the clients depend on, the clients built from the
+// same settings share their connections
+type clientKey struct {
+	http      HTTPSettings
+	socks5    string
+	userAgent string
+	ipType    string
+	useProxy  bool
+}
+
+var (
+	clients   = map[clientKey]*http.Client{}
+	clientsMu sync.Mutex
+)
+
+// GetHttpClient returns the HTTP client of the settings, through the proxy
+// when useProxy is set. The clients are shared, and never nil: when the
+// settings are wrong, the error is logged and returned by every request.
+func GetHttpClient(configuration *Settings, useProxy bool) *http.Client {
+	key := clientKey{
+		http:      configuration.HTTP,
+		socks5:    configuration.Socks5Proxy,
+		userAgent: configuration.UserAgent,
+		ipType:    configuration.IPType,
+		useProxy:  useProxy,
+	}
+
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if client, ok := clients[key]; ok {
+		return client
+	}
+
+	client, err := NewHTTPClient(configuration, useProxy)
+	if err != nil {
+		Error("Cannot create the HTTP client:", err)
+		client = &http.Client{Transport: failingTransport{err}}
+	}
+	clients[key] = client
+	return client
+}
+
+// NewHTTPClient creates an HTTP client from the http settings
+func NewHTTPClient(configuration *Settings, useProxy bool) (*http.Client, error) {
+	conf := configuration.HTTP
+
+	timeout := DefaultHTTPTimeout
+	if conf.Timeout > 0 {
+		timeout = time.Duration(conf.Timeout) * time.Second
+	}
+
+	base, err := newTransport(configuration, useProxy)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := configuration.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &userAgentTransport{next: traceTransport(base), userAgent: userAgent},
+	}, nil
+}
+
+// newTransport returns the transport of the settings, nil for
+// http.DefaultTransport when nothing differs from it
+func newTransport(configuration *Settings, useProxy bool) (http.RoundTripper, error) {
+	conf := configuration.HTTP
+
+	proxyURL := ""
+	if useProxy {
+		proxyURL = conf.Proxy
+		if proxyURL == "" && configuration.Socks5Proxy != "" {
+			proxyURL = "socks5://" + configuration.Socks5Proxy
+		}
+	}
+
+	if proxyURL == "" && conf.CABundle == "" && conf.TLSMinVersion == "" && conf.SourceIP == "" && conf.SourceInterface == "" && conf.ConnectTimeout == 0 {
+		return nil, nil
+	}
+
+	connectTimeout := DefaultConnectTimeout
+	if conf.ConnectTimeout > 0 {
+		connectTimeout = time.Duration(conf.ConnectTimeout) * time.Second
+	}
+
+	dialer, err := newSourceDialer(conf, configuration.IPType, connectTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   connectTimeout,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+
+	if conf.TLSMinVersion != "" {
+		version, ok := tlsVersions[conf.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls_min_version %q, must be 1.0, 1.1, 1.2 or 1.3", conf.TLSMinVersion)
+		}
+		transport.TLSClientConfig.MinVersion = version
+	}
+
+	if conf.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(conf.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", conf.CABundle)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %s", RedactError(err))
+		}
+		if u.User != nil {
+			password, _ := u.User.Password()
+			RegisterSecret(password)
+		}
+
+		switch u.Scheme {
+		case "http", "https":
+			transport.Proxy = http.ProxyURL(u)
+		case "socks5", "socks5h":
+			var auth *proxy.Auth
+			if u.User != nil {
+				password, _ := u.User.Password()
+				auth = &proxy.Auth{User: u.User.Username(), Password: password}
+			}
+			socks, err := proxy.SOCKS5("tcp", u.Host, auth, dialer)
+			if err != nil {
+				return nil, err
+			}
+			transport.Proxy = nil
+			transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if d, ok := socks.(proxy.ContextDialer); ok {
+					return d.DialContext(ctx, network, addr)
+				}
+				return socks.Dial(network, addr)
+			}
+		default:
+			return nil, fmt.Errorf("unknown proxy scheme %q, must be http, https or socks5", u.Scheme)
+		}
+	}
+
+	return transport, nil
+}
+
+// sourceDialer dials from source_ip, or from an address of
+// source_interface of the family of ip_type
+type sourceDialer struct {
+	net.Dialer
+	iface  string
+	ipType string
+}
+
+func newSourceDialer(conf HTTPSettings, ipType string, timeout time.Duration) (*sourceDialer, error) {
+	d := &sourceDialer{Dialer: net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}, iface: conf.SourceInterface, ipType: ipType}
+
+	if conf.SourceIP != "" {
+		ip := net.ParseIP(conf.SourceIP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source_ip %q", conf.SourceIP)
+		}
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	if conf.SourceInterface != "" {
+		if _, err := net.InterfaceByName(conf.SourceInterface); err != nil {
+			return nil, fmt.Errorf("invalid source_interface %q: %s", conf.SourceInterface, err)
+		}
+	}
+	return d, nil
+}
+
+func (d *sourceDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := d.Dialer
+	if d.iface != "" {
+		ip, err := interfaceAddress(d.iface, strings.ToUpper(d.ipType) == IPV6)
+		if err != nil {
+			return nil, err
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	// the address family has to match the source address
+	if local, ok := dialer.LocalAddr.(*net.TCPAddr); ok && network == "tcp" {
+		network = "tcp6"
+		if local.IP.To4() != nil {
+			network = "tcp4"
+		}
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// Dial makes sourceDialer a proxy.Dialer, for the SOCKS5 proxies
+func (d *sourceDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// interfaceAddress returns the first global address of the interface, an
+// IPv6 one when ipv6 is set; it is looked up on every connection as the
+// addresses may change
+func interfaceAddress(name string, ipv6 bool) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || !ipnet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if (ipnet.IP.To4() == nil) == ipv6 {
+			return ipnet.IP, nil
+		}
+	}
+	return nil, errors.New("no usable address on interface " + name)
+}
+
+// userAgentTransport sets the User-Agent of the requests which have none,
+// such as the webhook headers or the one DNSPod requires
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// failingTransport fails every request with the error which prevented
+// creating the client
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, t.err
+}
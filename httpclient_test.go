@@ -0,0 +1,79 @@
+package godns
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPClientUserAgent(t *testing.T) {
+	var userAgents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+	}))
+	defer server.Close()
+
+	client := GetHttpClient(&Settings{}, false)
+	if client != GetHttpClient(&Settings{}, false) {
+		t.Error("the clients of the same settings should be shared")
+	}
+	if client.Timeout != DefaultHTTPTimeout {
+		t.Errorf("expected the default timeout, got %s", client.Timeout)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// the handlers requiring their own User-Agent keep it
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("User-Agent", "GoDNS/2 (me@example.com)")
+	resp, err = GetHttpClient(&Settings{UserAgent: "custom"}, false).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if strings.Join(userAgents, ",") != DefaultUserAgent+",GoDNS/2 (me@example.com)" {
+		t.Errorf("unexpected User-Agents %q", userAgents)
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String() + " " + r.Header.Get("Proxy-Authorization")
+		w.Write([]byte("203.0.113.7"))
+	}))
+	defer proxy.Close()
+
+	settings := &Settings{HTTP: HTTPSettings{Proxy: strings.Replace(proxy.URL, "http://", "http://user:proxy-secret@", 1)}}
+	resp, err := GetHttpClient(settings, true).Get("http://api.example.net/ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "203.0.113.7" || !strings.HasPrefix(proxied, "http://api.example.net/ip Basic ") {
+		t.Errorf("the request should go through the proxy, got %q", proxied)
+	}
+	if Redact("proxy-secret") != Redacted {
+		t.Error("the proxy password should be redacted")
+	}
+}
+
+func TestHTTPClientInvalidSettings(t *testing.T) {
+	client := GetHttpClient(&Settings{HTTP: HTTPSettings{TLSMinVersion: "1.4"}}, false)
+	if client == nil {
+		t.Fatal("the client should never be nil")
+	}
+	if _, err := client.Get("http://127.0.0.1:1"); err == nil || !strings.Contains(err.Error(), "tls_min_version") {
+		t.Errorf("the requests should fail with the settings error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package godns
+
+import "sort"
+
+// IPSourceOf returns the name of the ip_sources entry of subDomain, empty
+// for the IP settings of the top level
+func (d *Domain) IPSourceOf(subDomain string) string {
+	if name, ok := d.SubDomainIPSources[subDomain]; ok {
+		return name
+	}
+	return d.IPSource
+}
+
+// SplitByIPSource returns the domains with a single IP source each, so
+// that the subdomains of different uplinks are checked by loops of their
+// own. The domains of a single IP source, or of a failover, are returned
+// as they are.
+func SplitByIPSource(domains []Domain) []Domain {
+	var result []Domain
+	for _, domain := range domains {
+		if len(domain.Failover.IPSources) > 0 {
+			result = append(result, domain)
+			continue
+		}
+
+		bySource := map[string][]string{}
+		for _, subDomain := range domain.SubDomains {
+			name := domain.IPSourceOf(subDomain)
+			bySource[name] = append(bySource[name], subDomain)
+		}
+		if len(bySource) <= 1 {
+			if len(domain.SubDomains) > 0 {
+				domain.IPSource = domain.IPSourceOf(domain.SubDomains[0])
+			}
+			domain.SubDomainIPSources = nil
+			result = append(result, domain)
+			continue
+		}
+
+		var names []string
+		for name := range bySource {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			part := domain
+			part.SubDomains = bySource[name]
+			part.IPSource = name
+			part.SubDomainIPSources = nil
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// IPSourceSettings returns the settings finding the current IP with the
+// ip_sources entry name: its interface, its URLs or else the top level
+// ones, sent from its source address or else from its interface. It
+// returns configuration itself for an empty or unknown name.
+func IPSourceSettings(configuration *Settings, name string) *Settings {
+	source, ok := configuration.IPSources[name]
+	if name == "" || !ok {
+		return configuration
+	}
+
+	settings := *configuration
+	settings.IPInterface = source.IPInterface
+	if source.IPUrl != "" {
+		settings.IPUrl = source.IPUrl
+	}
+	if source.IPV6Url != "" {
+		settings.IPV6Url = source.IPV6Url
+	}
+	settings.HTTP.SourceIP = source.SourceIP
+	settings.HTTP.SourceInterface = source.SourceInterface
+	if source.SourceIP == "" && source.SourceInterface == "" {
+		settings.HTTP.SourceInterface = source.IPInterface
+	}
+	return &settings
+}
+
+// GetDomainIP gets the current IP of the subdomains of domain, from its
+// IP source, or from the healthy one of its failover
+func GetDomainIP(configuration *Settings, domain *Domain) (string, error) {
+	if len(domain.Failover.IPSources) > 0 {
+		return getFailoverIP(configuration, domain)
+	}
+	return GetCurrentIP(IPSourceSettings(configuration, domain.IPSource))
+}
@@ -0,0 +1,66 @@
+package godns
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSplitByIPSource(t *testing.T) {
+	domains := []Domain{
+		{DomainName: "example.com", SubDomains: []string{"www", "wan1", "wan2"}, SubDomainIPSources: map[string]string{"wan1": "wan1", "wan2": "wan2"}},
+		{DomainName: "example.org", SubDomains: []string{"www"}, IPSource: "wan2"},
+	}
+
+	var got []string
+	for _, domain := range SplitByIPSource(domains) {
+		got = append(got, fmt.Sprintf("%s %v %q", domain.DomainName, domain.SubDomains, domain.IPSource))
+	}
+	expected := []string{
+		`example.com [www] ""`,
+		`example.com [wan1] "wan1"`,
+		`example.com [wan2] "wan2"`,
+		`example.org [www] "wan2"`,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestGetDomainIP(t *testing.T) {
+	echo := func(ip string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, ip)
+		}))
+	}
+	wan1 := echo("198.51.100.1")
+	defer wan1.Close()
+	wan2 := echo("203.0.113.2")
+	defer wan2.Close()
+
+	settings := &Settings{
+		IPType: IPV4,
+		IPUrl:  wan1.URL,
+		IPSources: map[string]IPSource{
+			"wan2": {IPUrl: wan2.URL, SourceIP: "127.0.0.1"},
+		},
+	}
+	for source, expected := range map[string]string{"": "198.51.100.1", "wan2": "203.0.113.2"} {
+		ip, err := GetDomainIP(settings, &Domain{DomainName: "example.com", SubDomains: []string{"www"}, IPSource: source})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip != expected {
+			t.Errorf("%q: expected %s, got %s", source, expected, ip)
+		}
+	}
+
+	if IPSourceSettings(settings, "wan2").HTTP.SourceIP != "127.0.0.1" || settings.HTTP.SourceIP != "" {
+		t.Error("the IP source settings should be a copy, sent from the source address")
+	}
+	if IPSourceSettings(&Settings{IPSources: map[string]IPSource{"ppp": {IPInterface: "ppp0"}}}, "ppp").HTTP.SourceInterface != "ppp0" {
+		t.Error("the IP lookup should be sent from ip_interface by default")
+	}
+}
@@ -0,0 +1,349 @@
+package godns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+// Log levels, from the most verbose
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Log formats
+const (
+	LogText = "text"
+	LogJSON = "json"
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses debug, info, warn or error, an empty level is info
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return LevelInfo, nil
+	case "warning":
+		return LevelWarn, nil
+	}
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, must be debug, info, warn or error", s)
+}
+
+// Fields are the key-value pairs attached to a log entry, such as the
+// provider and the domain it is about
+type Fields map[string]interface{}
+
+// sink receives the formatted entries of the logger
+type sink interface {
+	write(entry *logEntry) error
+}
+
+// logEntry is an entry once its message is formatted
+type logEntry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  Fields
+}
+
+// Logger writes leveled entries in text or JSON to its sinks
+type Logger struct {
+	mu     sync.Mutex
+	level  Level
+	format string
+	out    io.Writer
+	sinks  []sink
+	closer []io.Closer
+}
+
+// std is the logger of the package functions, it writes text to stderr
+// until SetupLogger is called
+var std = &Logger{level: LevelInfo, format: LogText, out: os.Stderr}
+
+// SetupLogger configures the logger from the log_ settings: the level, the
+// format, the log_path file and its rotation, and syslog or journald. The
+// output of the log package is sent to the logger, at the info level.
+func SetupLogger(configuration *Settings) error {
+	level, err := ParseLevel(configuration.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	format := strings.ToLower(configuration.LogFormat)
+	switch format {
+	case "":
+		format = LogText
+	case LogText, LogJSON:
+	default:
+		return fmt.Errorf("unknown log format %q, must be text or json", configuration.LogFormat)
+	}
+
+	var out io.Writer = os.Stderr
+	var closers []io.Closer
+	if configuration.LogPath != "" {
+		file, err := newRotateWriter(configuration.LogPath, configuration.LogMaxSize, configuration.LogMaxAge, configuration.LogBackups)
+		if err != nil {
+			return err
+		}
+		out = file
+		closers = append(closers, file)
+	}
+
+	var sinks []sink
+	if configuration.LogSyslog != "" {
+		s, err := newSystemSink(configuration.LogSyslog)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, s)
+		if c, ok := s.(io.Closer); ok {
+			closers = append(closers, c)
+		}
+	}
+
+	std.mu.Lock()
+	for _, c := range std.closer {
+		c.Close()
+	}
+	std.level = level
+	std.format = format
+	std.out = out
+	std.sinks = sinks
+	std.closer = closers
+	std.mu.Unlock()
+
+	log.SetPrefix("")
+	log.SetFlags(0)
+	log.SetOutput(stdLogWriter{})
+	return nil
+}
+
+// stdLogWriter sends the lines of the log package to the logger
+type stdLogWriter struct{}
+
+func (stdLogWriter) Write(p []byte) (int, error) {
+	std.log(LevelInfo, nil, string(p))
+	return len(p), nil
+}
+
+func (l *Logger) log(level Level, fields Fields, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level < l.level {
+		return
+	}
+
+	entry := &logEntry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: Redact(strings.TrimRight(msg, "\r\n ")),
+		Fields:  fields,
+	}
+
+	var line []byte
+	if l.format == LogJSON {
+		line = entry.json()
+	} else {
+		line = entry.text()
+	}
+	l.out.Write(line)
+
+	for _, s := range l.sinks {
+		if err := s.write(entry); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot write log entry:", err)
+		}
+	}
+}
+
+// text formats the entry as
+// [GoDNS] 2006/01/02 15:04:05 INFO message provider=Cloudflare domain=example.com
+func (e *logEntry) text() []byte {
+	var b bytes.Buffer
+	b.WriteString("[GoDNS] ")
+	b.WriteString(e.Time.Format("2006/01/02 15:04:05"))
+	b.WriteString(" ")
+	b.WriteString(strings.ToUpper(e.Level.String()))
+	b.WriteString(" ")
+	b.WriteString(e.Message)
+	for _, key := range e.keys() {
+		value := Redact(fmt.Sprint(e.Fields[key]))
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", key, value)
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// json formats the entry as a JSON object on a single line, with time,
+// level, msg and the fields
+func (e *logEntry) json() []byte {
+	object := map[string]interface{}{}
+	for key, value := range e.Fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		if s, ok := value.(string); ok {
+			value = Redact(s)
+		}
+		object[key] = value
+	}
+	object["time"] = e.Time.Format(time.RFC3339)
+	object["level"] = e.Level.String()
+	object["msg"] = e.Message
+
+	content, err := json.Marshal(object)
+	if err != nil {
+		content, _ = json.Marshal(map[string]interface{}{"time": object["time"], "level": object["level"], "msg": e.Message})
+	}
+	return append(content, '\n')
+}
+
+func (e *logEntry) keys() []string {
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Entry logs with a set of fields
+type Entry struct {
+	fields Fields
+}
+
+// WithFields returns an entry logging with fields
+func WithFields(fields Fields) *Entry {
+	return &Entry{fields: fields}
+}
+
+// ProviderLog returns an entry logging with the provider field
+func ProviderLog(provider string) *Entry {
+	return WithFields(Fields{"provider": provider})
+}
+
+// WithFields returns an entry logging with the fields of e and fields
+func (e *Entry) WithFields(fields Fields) *Entry {
+	merged := Fields{}
+	for key, value := range e.fields {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &Entry{fields: merged}
+}
+
+// WithDomain returns an entry logging with the domain field
+func (e *Entry) WithDomain(domain string) *Entry {
+	return e.WithFields(Fields{"domain": domain})
+}
+
+// Debug logs its operands at the debug level, spaced as by fmt.Sprintln
+func (e *Entry) Debug(args ...interface{}) {
+	std.log(LevelDebug, e.fields, fmt.Sprintln(args...))
+}
+
+// Info logs its operands at the info level, spaced as by fmt.Sprintln
+func (e *Entry) Info(args ...interface{}) {
+	std.log(LevelInfo, e.fields, fmt.Sprintln(args...))
+}
+
+// Warn logs its operands at the warn level, spaced as by fmt.Sprintln
+func (e *Entry) Warn(args ...interface{}) {
+	std.log(LevelWarn, e.fields, fmt.Sprintln(args...))
+}
+
+// Error logs its operands at the error level, spaced as by fmt.Sprintln
+func (e *Entry) Error(args ...interface{}) {
+	std.log(LevelError, e.fields, fmt.Sprintln(args...))
+}
+
+// Debugf logs at the debug level
+func (e *Entry) Debugf(format string, args ...interface{}) {
+	std.log(LevelDebug, e.fields, fmt.Sprintf(format, args...))
+}
+
+// Infof logs at the info level
+func (e *Entry) Infof(format string, args ...interface{}) {
+	std.log(LevelInfo, e.fields, fmt.Sprintf(format, args...))
+}
+
+// Warnf logs at the warn level
+func (e *Entry) Warnf(format string, args ...interface{}) {
+	std.log(LevelWarn, e.fields, fmt.Sprintf(format, args...))
+}
+
+// Errorf logs at the error level
+func (e *Entry) Errorf(format string, args ...interface{}) {
+	std.log(LevelError, e.fields, fmt.Sprintf(format, args...))
+}
+
+// Debug logs its operands at the debug level, without fields
+func Debug(args ...interface{}) {
+	std.log(LevelDebug, nil, fmt.Sprintln(args...))
+}
+
+// Info logs its operands at the info level, without fields
+func Info(args ...interface{}) {
+	std.log(LevelInfo, nil, fmt.Sprintln(args...))
+}
+
+// Warn logs its operands at the warn level, without fields
+func Warn(args ...interface{}) {
+	std.log(LevelWarn, nil, fmt.Sprintln(args...))
+}
+
+// Error logs its operands at the error level, without fields
+func Error(args ...interface{}) {
+	std.log(LevelError, nil, fmt.Sprintln(args...))
+}
+
+// Debugf logs at the debug level, without fields
+func Debugf(format string, args ...interface{}) {
+	std.log(LevelDebug, nil, fmt.Sprintf(format, args...))
+}
+
+// Infof logs at the info level, without fields
+func Infof(format string, args ...interface{}) {
+	std.log(LevelInfo, nil, fmt.Sprintf(format, args...))
+}
+
+// Warnf logs at the warn level, without fields
+func Warnf(format string, args ...interface{}) {
+	std.log(LevelWarn, nil, fmt.Sprintf(format, args...))
+}
+
+// Errorf logs at the error level, without fields
+func Errorf(format string, args ...interface{}) {
+	std.log(LevelError, nil, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,156 @@
+package godns
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is appended to log_path to name the rotated files, they
+// sort by name from the oldest
+const backupTimeFormat = "20060102-150405"
+
+// rotateRetryDelay is how long the rotation waits after a failure before it
+// is tried again
+const rotateRetryDelay = time.Minute
+
+// rotateWriter writes to log_path, and renames it to log_path.<time> once
+// it is larger than maxSize MB or was opened more than maxAge days ago.
+// Only the maxBackups latest rotated files are kept, and none older than
+// maxAge days; 0 means no limit.
+type rotateWriter struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	file   *os.File
+	size   int64
+	opened time.Time
+	// retry is when a failed rotation is tried again
+	retry time.Time
+}
+
+func newRotateWriter(path string, maxSize, maxAge, maxBackups int) (*rotateWriter, error) {
+	w := &rotateWriter{
+		path:       path,
+		maxSize:    int64(maxSize) * 1024 * 1024,
+		maxAge:     time.Duration(maxAge) * 24 * time.Hour,
+		maxBackups: maxBackups,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	if dir := filepath.Dir(w.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+	w.opened = time.Now()
+	return nil
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.due(len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotateWriter) due(n int) bool {
+	if w.size == 0 || time.Now().Before(w.retry) {
+		return false
+	}
+	if w.maxSize > 0 && w.size+int64(n) > w.maxSize {
+		return true
+	}
+	return w.maxAge > 0 && time.Since(w.opened) > w.maxAge
+}
+
+// rotate renames the file and opens a new one. When the renaming or the
+// opening fails, log_path is opened again to go on appending to it, and the
+// rotation is tried again after rotateRetryDelay.
+func (w *rotateWriter) rotate() error {
+	w.file.Close()
+
+	// the milliseconds tell apart the files rotated in the same second
+	backup := w.path + "." + time.Now().Format(backupTimeFormat+".000")
+	err := os.Rename(w.path, backup)
+	if err == nil {
+		err = w.open()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot rotate %s: %s\n", w.path, err)
+		w.retry = time.Now().Add(rotateRetryDelay)
+		return w.open()
+	}
+
+	w.prune()
+	return nil
+}
+
+// prune removes the rotated files beyond maxBackups or older than maxAge
+func (w *rotateWriter) prune() {
+	backups, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return
+	}
+
+	var rotated []string
+	for _, backup := range backups {
+		stamp := strings.TrimPrefix(backup, w.path+".")
+		if len(stamp) >= len(backupTimeFormat) {
+			if _, err := time.Parse(backupTimeFormat, stamp[:len(backupTimeFormat)]); err == nil {
+				rotated = append(rotated, backup)
+			}
+		}
+	}
+	// newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(rotated)))
+
+	for i, backup := range rotated {
+		info, err := os.Stat(backup)
+		if err != nil {
+			continue
+		}
+		if (w.maxBackups > 0 && i >= w.maxBackups) || (w.maxAge > 0 && time.Since(info.ModTime()) > w.maxAge) {
+			os.Remove(backup)
+		}
+	}
+}
+
+func (w *rotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
@@ -0,0 +1,132 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package godns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/syslog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// journalSocket is where journald reads its native protocol from
+const journalSocket = "/run/systemd/journal/socket"
+
+// newSystemSink connects to the log_syslog destination: syslog for the
+// local syslog daemon, udp://host:port or tcp://host:port for a remote
+// one, or journald
+func newSystemSink(destination string) (sink, error) {
+	switch {
+	case destination == "journald":
+		conn, err := net.Dial("unixgram", journalSocket)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to journald: %s", err)
+		}
+		return &journalSink{conn: conn}, nil
+	case destination == "syslog":
+		w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "godns")
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to syslog: %s", err)
+		}
+		return &syslogSink{w: w}, nil
+	case strings.HasPrefix(destination, "udp://"), strings.HasPrefix(destination, "tcp://"):
+		u, err := url.Parse(destination)
+		if err != nil {
+			return nil, err
+		}
+		w, err := syslog.Dial(u.Scheme, u.Host, syslog.LOG_DAEMON|syslog.LOG_INFO, "godns")
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to syslog %s: %s", destination, err)
+		}
+		return &syslogSink{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown log_syslog %q, must be syslog, journald, udp://host:port or tcp://host:port", destination)
+}
+
+// syslogSink writes the entries as text, with their syslog severity
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func (s *syslogSink) write(entry *logEntry) error {
+	// syslog stamps the entries, drop the prefix and the time of the text
+	line := string(entry.text())
+	if i := strings.Index(line, strings.ToUpper(entry.Level.String())+" "); i >= 0 {
+		line = line[i:]
+	}
+	line = strings.TrimSuffix(line, "\n")
+
+	switch entry.Level {
+	case LevelDebug:
+		return s.w.Debug(line)
+	case LevelWarn:
+		return s.w.Warning(line)
+	case LevelError:
+		return s.w.Err(line)
+	}
+	return s.w.Info(line)
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
+
+// journalSink writes the entries with the native journald protocol, the
+// fields becoming GODNS_ journal fields such as GODNS_DOMAIN
+type journalSink struct {
+	conn net.Conn
+}
+
+var journalPriority = map[Level]int{LevelDebug: 7, LevelInfo: 6, LevelWarn: 4, LevelError: 3}
+
+func (s *journalSink) write(entry *logEntry) error {
+	var b bytes.Buffer
+	journalField(&b, "MESSAGE", entry.Message)
+	journalField(&b, "PRIORITY", fmt.Sprint(journalPriority[entry.Level]))
+	journalField(&b, "SYSLOG_IDENTIFIER", "godns")
+	journalField(&b, "SYSLOG_PID", fmt.Sprint(os.Getpid()))
+	for _, key := range entry.keys() {
+		journalField(&b, "GODNS_"+journalKey(key), Redact(fmt.Sprint(entry.Fields[key])))
+	}
+	_, err := s.conn.Write(b.Bytes())
+	return err
+}
+
+func (s *journalSink) Close() error {
+	return s.conn.Close()
+}
+
+// journalField writes KEY=value, or the binary form for the values with
+// a new line
+func journalField(b *bytes.Buffer, key, value string) {
+	b.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		b.WriteString("=")
+		b.WriteString(value)
+		b.WriteString("\n")
+		return
+	}
+	b.WriteString("\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteString("\n")
+}
+
+// journalKey turns key into a journal field name: upper case letters,
+// digits and underscores
+func journalKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package godns
+
+import (
+	"fmt"
+)
+
+// newSystemSink fails, there is neither syslog nor journald on this system
+func newSystemSink(destination string) (sink, error) {
+	return nil, fmt.Errorf("log_syslog %q is not supported on this system", destination)
+}
@@ -0,0 +1,135 @@
+package godns
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoggerText(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(level Level, format string, out io.Writer) { std.level, std.format, std.out = level, format, out }(std.level, std.format, std.out)
+	std.level, std.format, std.out = LevelInfo, LogText, &buf
+
+	RegisterSecret("logger-secret")
+	entry := ProviderLog("Cloudflare").WithDomain("example.com")
+	entry.Debug("hidden")
+	entry.Info("Current IP is:", "1.2.3.4")
+	entry.Warnf("token logger-secret rejected\r\n")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	if !strings.HasSuffix(lines[0], " INFO Current IP is: 1.2.3.4 domain=example.com provider=Cloudflare") {
+		t.Errorf("unexpected line %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], " WARN token "+Redacted+" rejected domain=example.com provider=Cloudflare") {
+		t.Errorf("unexpected line %q", lines[1])
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(level Level, format string, out io.Writer) { std.level, std.format, std.out = level, format, out }(std.level, std.format, std.out)
+	std.level, std.format, std.out = LevelDebug, LogJSON, &buf
+
+	WithFields(Fields{"domain": "example.com", "attempt": 2}).Debugf("Querying %s", "www")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "debug" || entry["msg"] != "Querying www" || entry["domain"] != "example.com" || entry["attempt"] != 2.0 {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"": LevelInfo, "DEBUG": LevelDebug, "warning": LevelWarn, "error": LevelError} {
+		if level, err := ParseLevel(s); err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", s, level, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("verbose should be rejected")
+	}
+}
+
+func TestRotateWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godns-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "godns.log")
+	w, err := newRotateWriter(path, 1, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	line := bytes.Repeat([]byte("x"), 400*1024)
+	for i := 0; i < 12; i++ {
+		if _, err := w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Errorf("expected 2 rotated files, got %v", backups)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 1024*1024 {
+		t.Errorf("%s was not rotated, size %d", path, info.Size())
+	}
+}
+
+func TestRotateWriterFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godns-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "godns.log")
+	w, err := newRotateWriter(path, 1, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	line := bytes.Repeat([]byte("x"), 600*1024)
+	if _, err := w.Write(line); err != nil {
+		t.Fatal(err)
+	}
+
+	// the renaming fails once the file is gone
+	os.Remove(path)
+	for i := 0; i < 2; i++ {
+		if _, err := w.Write(line); err != nil {
+			t.Fatalf("logging should go on after a failed rotation, got %v", err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(2*len(line)) {
+		t.Errorf("%s should be opened again, size %d", path, info.Size())
+	}
+	if w.retry.IsZero() {
+		t.Error("the rotation should be tried again later")
+	}
+}
@@ -0,0 +1,91 @@
+package godns
+
+// MemberSetter is implemented by the handlers of the providers keeping
+// several addresses in a record, for the membership subdomains
+type MemberSetter interface {
+	// ListMembers returns the addresses of the record of subDomain, of
+	// the type of ip_type
+	ListMembers(domain, subDomain string) ([]string, error)
+	// AddMember adds ip to the record of subDomain
+	AddMember(domain, subDomain, ip string) error
+	// RemoveMember removes ip from the record of subDomain, leaving the
+	// other addresses
+	RemoveMember(domain, subDomain, ip string) error
+}
+
+// IsMember reports whether subDomain is a round-robin record this host is
+// one member of
+func (d *Domain) IsMember(subDomain string) bool {
+	for _, member := range d.Membership {
+		if member == subDomain {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateMember adds currentIP to the record of subDomain, and removes the
+// previous address of this host, known from the state store. The
+// addresses of the other members are left as they are.
+func UpdateMember(configuration *Settings, setter MemberSetter, domain *Domain, subDomain, currentIP string) error {
+	hostname := subDomain + "." + domain.DomainName
+	store := GetStateStore(configuration)
+
+	members, err := setter.ListMembers(domain.DomainName, subDomain)
+	if err != nil {
+		return err
+	}
+	isMember := map[string]bool{}
+	for _, member := range members {
+		isMember[member] = true
+	}
+
+	changed := false
+	if !isMember[currentIP] {
+		Infof("Adding %s to the members of %s", currentIP, hostname)
+		if err := setter.AddMember(domain.DomainName, subDomain, currentIP); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if state, ok := store.Get(hostname); ok && state.IP != currentIP && isMember[state.IP] {
+		Infof("Removing the previous address %s from the members of %s", state.IP, hostname)
+		if err := setter.RemoveMember(domain.DomainName, subDomain, state.IP); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	store.SetIP(hostname, currentIP)
+	if changed {
+		if err := SendNotify(configuration, hostname, currentIP); err != nil {
+			Error("Failed to send notification")
+		}
+	}
+	return nil
+}
+
+// WithdrawMembers removes the address of this host from the membership
+// records of the domains with withdraw_on_exit, it is called when GoDNS
+// stops
+func WithdrawMembers(configuration *Settings, setter MemberSetter) {
+	store := GetStateStore(configuration)
+	for _, domain := range configuration.Domains {
+		if !domain.WithdrawOnExit {
+			continue
+		}
+		for _, subDomain := range domain.Membership {
+			hostname := subDomain + "." + domain.DomainName
+			state, ok := store.Get(hostname)
+			if !ok || state.IP == "" {
+				continue
+			}
+			if err := setter.RemoveMember(domain.DomainName, subDomain, state.IP); err != nil {
+				Errorf("Failed to withdraw %s from %s: %s", state.IP, hostname, err)
+				continue
+			}
+			Infof("Withdrew %s from the members of %s", state.IP, hostname)
+		}
+	}
+}
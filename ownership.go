@@ -0,0 +1,74 @@
+package godns
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultOwnerID is the owner_id of the instances which do not set one
+	DefaultOwnerID = "default"
+	// OwnershipPrefix is prepended to the name of the companion TXT records
+	// holding the markers, for the providers without record comments
+	OwnershipPrefix = "_godns"
+)
+
+var (
+	// ownerPattern finds the marker in a record comment or TXT value
+	ownerPattern   = regexp.MustCompile(`heritage=godns,godns/owner=([A-Za-z0-9._-]+)`)
+	ownerIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+)
+
+// OwnerMarker returns the marker of the records owned by this instance,
+// such as heritage=godns,godns/owner=default
+func OwnerMarker(configuration *Settings) string {
+	id := configuration.Ownership.OwnerID
+	if id == "" {
+		id = DefaultOwnerID
+	}
+	return "heritage=godns,godns/owner=" + id
+}
+
+// CheckOwner tells whether the record of hostname, whose comment or
+// companion TXT record is text, may be modified: it may when ownership is
+// disabled, when text has the marker of this instance, or when text has no
+// marker and hostname is adopted. The records marked by another instance
+// are never modified, adopted or not.
+func CheckOwner(configuration *Settings, hostname, text string) error {
+	if !configuration.Ownership.Enabled {
+		return nil
+	}
+
+	if match := ownerPattern.FindStringSubmatch(text); match != nil {
+		if "heritage=godns,godns/owner="+match[1] == OwnerMarker(configuration) {
+			return nil
+		}
+		return fmt.Errorf("%s is owned by the GoDNS instance %q", hostname, match[1])
+	}
+
+	for _, adopted := range configuration.Ownership.Adopt {
+		if strings.EqualFold(strings.TrimSuffix(adopted, "."), hostname) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s has no ownership marker, add it to ownership.adopt to take it over", hostname)
+}
+
+// MarkOwned returns text with the marker of this instance, in place of the
+// marker of another one
+func MarkOwned(configuration *Settings, text string) string {
+	if ownerPattern.MatchString(text) {
+		return ownerPattern.ReplaceAllLiteralString(text, OwnerMarker(configuration))
+	}
+	return strings.TrimSpace(text + " " + OwnerMarker(configuration))
+}
+
+// OwnershipName returns the name of the companion TXT record of subDomain,
+// relative to its domain
+func OwnershipName(subDomain string) string {
+	if subDomain == "@" || subDomain == "" {
+		return OwnershipPrefix
+	}
+	return OwnershipPrefix + "." + subDomain
+}
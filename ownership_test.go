@@ -0,0 +1,44 @@
+package godns
+
+import "testing"
+
+func TestCheckOwner(t *testing.T) {
+	settings := &Settings{Ownership: OwnershipSettings{Enabled: true, OwnerID: "office", Adopt: []string{"pinned.example.com."}}}
+
+	cases := []struct {
+		hostname string
+		text     string
+		owned    bool
+	}{
+		{"www.example.com", "heritage=godns,godns/owner=office", true},
+		{"www.example.com", "set by hand heritage=godns,godns/owner=office", true},
+		{"www.example.com", "heritage=godns,godns/owner=home", false},
+		{"www.example.com", "heritage=godns,godns/owner=office2", false},
+		{"www.example.com", "", false},
+		{"pinned.example.com", "", true},
+		{"pinned.example.com", "heritage=godns,godns/owner=home", false},
+	}
+	for _, c := range cases {
+		if err := CheckOwner(settings, c.hostname, c.text); (err == nil) != c.owned {
+			t.Errorf("%s %q: expected owned %v, got %v", c.hostname, c.text, c.owned, err)
+		}
+	}
+
+	if err := CheckOwner(&Settings{}, "www.example.com", ""); err != nil {
+		t.Errorf("every record is owned when ownership is disabled, got %v", err)
+	}
+}
+
+func TestMarkOwned(t *testing.T) {
+	settings := &Settings{Ownership: OwnershipSettings{Enabled: true}}
+
+	for text, expected := range map[string]string{
+		"":                                "heritage=godns,godns/owner=default",
+		"office router":                   "office router heritage=godns,godns/owner=default",
+		"heritage=godns,godns/owner=home": "heritage=godns,godns/owner=default",
+	} {
+		if got := MarkOwned(settings, text); got != expected {
+			t.Errorf("%q: expected %q, got %q", text, expected, got)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package godns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Handler is implemented by the handler of every provider
+type Handler interface {
+	SetConfiguration(*Settings)
+	DomainLoop(domain *Domain, panicChan chan<- Domain)
+}
+
+// Capabilities of a provider handler
+type Capabilities struct {
+	// IPv6 the handler can update AAAA records
+	IPv6 bool
+	// TXT the handler can manage TXT records
+	TXT bool
+	// CreateRecords the handler creates the records which do not exist yet
+	CreateRecords bool
+	// TTL the handler sets the TTL of the records
+	TTL bool
+	// Membership the handler adds and removes single addresses of
+	// round-robin records, see MemberSetter
+	Membership bool
+	// Ownership the handler marks the records it owns, and leaves the
+	// others, see CheckOwner
+	Ownership bool
+}
+
+// Provider describes a DNS provider, registered by its handler package
+type Provider struct {
+	Name        string
+	Description string
+	URL         string
+	// New creates a handler for the provider
+	New func() Handler
+	// ConfigKey is the config block of the provider, such as cloudflare
+	ConfigKey string
+	// Credentials is the typed struct of the config block of the provider,
+	// the fields with a doc tag are documented as credentials
+	Credentials interface{}
+	// Validate checks the settings of the provider, it may be nil
+	Validate func(*Settings) error
+	// Migrate moves the deprecated flat credentials to the config block of
+	// the provider with MigrateCredential, it may be nil
+	Migrate      func(*Settings)
+	Capabilities Capabilities
+}
+
+// ErrNotSupported is returned by the optional operations a provider
+// cannot perform
+var ErrNotSupported = errors.New("not supported by the provider")
+
+// Record is a DNS record as listed by a provider, Name is fully qualified
+// without the trailing dot
+type Record struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	TTL   int    `json:"ttl,omitempty"`
+}
+
+// CredentialField is a config field of the credentials of a provider
+type CredentialField struct {
+	Name        string
+	Description string
+}
+
+var providers = map[string]*Provider{}
+
+// RegisterProvider makes a provider available, it is called from the init
+// function of the handler packages
+func RegisterProvider(provider Provider) {
+	if _, ok := providers[provider.Name]; ok {
+		panic("provider registered twice: " + provider.Name)
+	}
+	providers[provider.Name] = &provider
+}
+
+// LookupProvider returns the registered provider called name
+func LookupProvider(name string) (*Provider, bool) {
+	provider, ok := providers[name]
+	return provider, ok
+}
+
+// Providers returns the registered providers, sorted by name
+func Providers() []*Provider {
+	list := make([]*Provider, 0, len(providers))
+	for _, provider := range providers {
+		list = append(list, provider)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+	return list
+}
+
+// ProviderNames returns the names of the registered providers
+func ProviderNames() []string {
+	var names []string
+	for _, provider := range Providers() {
+		names = append(names, provider.Name)
+	}
+	return names
+}
+
+// CredentialFields lists the config fields of the credentials of provider
+func (provider *Provider) CredentialFields() []CredentialField {
+	if provider.Credentials == nil {
+		return nil
+	}
+
+	t := reflect.TypeOf(provider.Credentials)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var fields []CredentialField
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		doc := t.Field(i).Tag.Get("doc")
+		if name == "" || name == "-" || doc == "" {
+			continue
+		}
+		if provider.ConfigKey != "" {
+			name = provider.ConfigKey + "." + name
+		}
+		fields = append(fields, CredentialField{Name: name, Description: doc})
+	}
+	return fields
+}
+
+// String lists the capabilities, such as "IPv6, TTL"
+func (c Capabilities) String() string {
+	var list []string
+	if c.IPv6 {
+		list = append(list, "IPv6")
+	}
+	if c.TXT {
+		list = append(list, "TXT")
+	}
+	if c.CreateRecords {
+		list = append(list, "record creation")
+	}
+	if c.TTL {
+		list = append(list, "TTL")
+	}
+	if c.Membership {
+		list = append(list, "round-robin membership")
+	}
+	if c.Ownership {
+		list = append(list, "ownership markers")
+	}
+	return strings.Join(list, ", ")
+}
+
+// ProvidersMarkdown documents the registered providers, their credentials
+// and their capabilities
+func ProvidersMarkdown() string {
+	var buf bytes.Buffer
+	buf.WriteString("| Provider | `provider` | Credentials | Capabilities |\n")
+	buf.WriteString("| --- | --- | --- | --- |\n")
+	for _, provider := range Providers() {
+		description := provider.Description
+		if provider.URL != "" {
+			description = fmt.Sprintf("[%s](%s)", description, provider.URL)
+		}
+
+		var credentials []string
+		for _, field := range provider.CredentialFields() {
+			credentials = append(credentials, fmt.Sprintf("`%s`: %s", field.Name, field.Description))
+		}
+
+		fmt.Fprintf(&buf, "| %s | `%s` | %s | %s |\n", description, provider.Name,
+			strings.Join(credentials, "<br>"), provider.Capabilities)
+	}
+	return buf.String()
+}
+
+// MigrateCredential moves the deprecated flat field from to its new place
+// to, unless to is already set, and warns about the deprecation
+func MigrateCredential(config *Settings, from *string, fromName string, to *string, toName string) {
+	if *from == "" {
+		return
+	}
+
+	if *to == "" {
+		*to = *from
+		Warnf("Deprecated: %s of provider %s is moved to %s, please update your config file", fromName, config.Provider, toName)
+	} else {
+		Warnf("Deprecated: %s of provider %s is ignored, %s is used instead", fromName, config.Provider, toName)
+	}
+	*from = ""
+}
+
+// migrateCredentials moves the flat credentials of the configured provider
+// to its config block
+func migrateCredentials(config *Settings) {
+	if provider, ok := LookupProvider(config.Provider); ok && provider.Migrate != nil {
+		provider.Migrate(config)
+	}
+}
+
+// checkProvider validates the settings of the configured provider
+func checkProvider(config *Settings, errs *ConfigErrors) {
+	provider, ok := LookupProvider(config.Provider)
+	if !ok {
+		errs.add("provider", "please provide supported DNS provider: %s", strings.Join(ProviderNames(), "/"))
+		return
+	}
+
+	if strings.ToUpper(config.IPType) == IPV6 && !provider.Capabilities.IPv6 {
+		errs.add("ip_type", "provider %s does not support IPv6", provider.Name)
+	}
+
+	if config.Ownership.Enabled && !provider.Capabilities.Ownership {
+		errs.add("ownership.enabled", "provider %s does not support ownership markers", provider.Name)
+	}
+
+	for i, domain := range config.Domains {
+		if len(domain.Membership) > 0 && !provider.Capabilities.Membership {
+			errs.add(fmt.Sprintf("domains[%d].membership", i), "provider %s does not support round-robin membership", provider.Name)
+		}
+	}
+
+	if provider.Validate != nil {
+		if err := provider.Validate(config); err != nil {
+			errs.add(provider.ConfigKey, "%s", err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package godns_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jmbayu/godns"
+	// register the providers
+	_ "github.com/jmbayu/godns/handler"
+)
+
+func TestProvidersDocumented(t *testing.T) {
+	readme, err := ioutil.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(readme), godns.ProvidersMarkdown()) {
+		t.Error("the providers of README.md are out of date, update them with the output of godns providers")
+	}
+}
+
+func TestCheckProvider(t *testing.T) {
+	if err := godns.CheckSettings(&godns.Settings{Provider: "Unknown"}); err == nil || !strings.Contains(err.Error(), "NoIP") {
+		t.Errorf("unknown provider should list the registered ones, got %v", err)
+	}
+
+	conf := &godns.Settings{Provider: godns.ALIDNS, Email: "id", Password: "secret", IPType: "IPv6"}
+	if err := godns.CheckSettings(conf); err == nil {
+		t.Error("AliDNS does not support IPv6, should be failed")
+	}
+}
+
+func TestMigrateCredentials(t *testing.T) {
+	file, err := ioutil.TempFile("", "godns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"provider": "Cloudflare", "email": "you@example.com", "password": "key", "cloudflare": {"api_token": "token"}}`)
+	file.Close()
+
+	var settings godns.Settings
+	if err := godns.LoadSettings(file.Name(), &settings); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := settings.Cloudflare
+	if conf.Email != "you@example.com" || conf.APIKey != "key" || conf.APIToken != "token" {
+		t.Errorf("flat credentials should be moved to the cloudflare section, got %+v", conf)
+	}
+	if settings.Email != "" || settings.Password != "" {
+		t.Error("flat credentials should be cleared once moved")
+	}
+}
@@ -20,10 +20,13 @@ type DNSResolver struct {
 	r          *rand.Rand
 }
 
-// New initializes DnsResolver.
+// New initializes DnsResolver. The servers use port 53 unless they are
+// given with a port, such as 127.0.0.1:5353.
 func New(servers []string) *DNSResolver {
 	for i := range servers {
-		servers[i] = net.JoinHostPort(servers[i], "53")
+		if _, _, err := net.SplitHostPort(servers[i]); err != nil {
+			servers[i] = net.JoinHostPort(servers[i], "53")
+		}
 	}
 
 	return &DNSResolver{servers, len(servers) * 2, rand.New(rand.NewSource(time.Now().UnixNano()))}
@@ -108,3 +111,50 @@ func (r *DNSResolver) lookupHost(host string, dnsType uint16, triesLeft int) ([]
 
 	return result, err
 }
+
+// LookupNS returns the name servers of the zone enclosing host.
+// It walks up the labels of host until a delegation is found.
+func (r *DNSResolver) LookupNS(host string) ([]string, error) {
+	labels := dns.SplitDomainName(host)
+	for i := range labels {
+		zone := dns.Fqdn(strings.Join(labels[i:], "."))
+		servers, err := r.lookupNS(zone, r.RetryTimes)
+		if err != nil {
+			return nil, err
+		}
+		if len(servers) > 0 {
+			return servers, nil
+		}
+	}
+
+	return nil, errors.New("no name servers found for " + host)
+}
+
+func (r *DNSResolver) lookupNS(zone string, triesLeft int) ([]string, error) {
+	m1 := new(dns.Msg)
+	m1.Id = dns.Id()
+	m1.RecursionDesired = true
+	m1.Question = []dns.Question{{Name: zone, Qtype: dns.TypeNS, Qclass: dns.ClassINET}}
+
+	in, err := dns.Exchange(m1, r.Servers[r.r.Intn(len(r.Servers))])
+	if err != nil {
+		if strings.HasSuffix(err.Error(), "i/o timeout") && triesLeft > 0 {
+			triesLeft--
+			return r.lookupNS(zone, triesLeft)
+		}
+		return nil, err
+	}
+
+	if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+		return nil, errors.New(dns.RcodeToString[in.Rcode])
+	}
+
+	var servers []string
+	for _, record := range in.Answer {
+		if t, ok := record.(*dns.NS); ok && strings.EqualFold(t.Hdr.Name, zone) {
+			servers = append(servers, t.Ns)
+		}
+	}
+
+	return servers, nil
+}
@@ -9,8 +9,8 @@ import (
 )
 
 func TestNew(t *testing.T) {
-	servers := []string{"8.8.8.8", "8.8.4.4"}
-	expectedServers := []string{"8.8.8.8:53", "8.8.4.4:53"}
+	servers := []string{"8.8.8.8", "8.8.4.4", "127.0.0.1:5353", "2001:4860:4860::8888", "[::1]:5353"}
+	expectedServers := []string{"8.8.8.8:53", "8.8.4.4:53", "127.0.0.1:5353", "[2001:4860:4860::8888]:53", "[::1]:5353"}
 	resolver := New(servers)
 
 	if !reflect.DeepEqual(resolver.Servers, expectedServers) {
@@ -0,0 +1,137 @@
+package godns
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SchemaURL is the address of the JSON Schema of the config file, set it
+// as $schema to get completion and validation in editors
+const SchemaURL = "https://raw.githubusercontent.com/jmbayu/godns/master/config.schema.json"
+
+// schemaRules adds the constraints which do not show in the Go types, by
+// path of the setting, [] standing for the items of a list and {} for the
+// values of a map
+var schemaRules = map[string]map[string]interface{}{
+	"domains[]":                         {"required": []string{"domain_name", "sub_domains"}},
+	"domains[].domain_name":             {"minLength": 1},
+	"domains[].sub_domains":             {"minItems": 1},
+	"domains[].failover.hold_down":      {"minimum": 0},
+	"http.timeout":                      {"minimum": 0},
+	"http.connect_timeout":              {"minimum": 0},
+	"http.proxy":                        {"pattern": "^((https?|socks5h?)://.+)?$"},
+	"http.tls_min_version":              {"enum": []string{"1.0", "1.1", "1.2", "1.3", ""}},
+	"interval":                          {"minimum": 0},
+	"ip_sources{}.health_check.type":    {"enum": []string{HealthICMP, HealthTCP, HealthHTTP, ""}},
+	"ip_sources{}.health_check.timeout": {"minimum": 0},
+	"ip_type":                           {"pattern": "^([iI][pP][vV][46])?$"},
+	"log_level":                         {"enum": []string{"debug", "info", "warn", "warning", "error", ""}},
+	"log_format":                        {"enum": []string{LogText, LogJSON, ""}},
+	"log_max_size":                      {"minimum": 0},
+	"log_max_age":                       {"minimum": 0},
+	"log_max_backups":                   {"minimum": 0},
+	"log_syslog":                        {"pattern": "^(syslog|journald|(udp|tcp)://.+)?$"},
+	"ownership.owner_id":                {"pattern": "^[A-Za-z0-9._-]*$"},
+	"notify.mail.smtp_port":             {"minimum": 0, "maximum": 65535},
+	"notify.influx.influx_port":         {"minimum": 0, "maximum": 65535},
+}
+
+// Schema returns the JSON Schema of the config file, generated from the
+// Settings types and the registered providers
+func Schema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(Settings{}), "")
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["$id"] = SchemaURL
+	schema["title"] = "GoDNS configuration"
+
+	properties := schema["properties"].(map[string]interface{})
+	properties["$schema"] = map[string]interface{}{"type": "string"}
+	properties["provider"].(map[string]interface{})["enum"] = ProviderNames()
+
+	sources := []string{CompareDNS, CompareProviderAPI, CompareLocalState}
+	for _, path := range []string{"compare_with", "domains[].compare_with"} {
+		schemaAt(schema, path)["items"].(map[string]interface{})["enum"] = sources
+	}
+
+	for _, provider := range Providers() {
+		if provider.ConfigKey == "" {
+			continue
+		}
+		if block, ok := properties[provider.ConfigKey].(map[string]interface{}); ok {
+			block["description"] = "settings of " + provider.Description
+		}
+	}
+
+	for path, rules := range schemaRules {
+		node := schemaAt(schema, path)
+		for key, value := range rules {
+			node[key] = value
+		}
+	}
+
+	content, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+// typeSchema describes the values of type t, doc is the description of the
+// field holding them
+func typeSchema(t reflect.Type, doc string) map[string]interface{} {
+	schema := map[string]interface{}{}
+	if doc != "" {
+		schema["description"] = doc
+	}
+
+	if t == rawMessageType {
+		// any value, handed over as it is
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		schema["type"] = "integer"
+	case reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = typeSchema(t.Elem(), "")
+	case reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = typeSchema(t.Elem(), "")
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if key := jsonName(field); key != "" {
+				properties[key] = typeSchema(field.Type, field.Tag.Get("doc"))
+			}
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+	}
+
+	return schema
+}
+
+// schemaAt returns the schema of the setting at path
+func schemaAt(schema map[string]interface{}, path string) map[string]interface{} {
+	for _, key := range strings.Split(path, ".") {
+		list := strings.HasSuffix(key, "[]")
+		values := strings.HasSuffix(key, "{}")
+		key = strings.TrimSuffix(strings.TrimSuffix(key, "[]"), "{}")
+		schema = schema["properties"].(map[string]interface{})[key].(map[string]interface{})
+		if list {
+			schema = schema["items"].(map[string]interface{})
+		}
+		if values {
+			schema = schema["additionalProperties"].(map[string]interface{})
+		}
+	}
+	return schema
+}
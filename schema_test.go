@@ -0,0 +1,24 @@
+package godns_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/jmbayu/godns"
+)
+
+func TestSchemaUpToDate(t *testing.T) {
+	committed, err := ioutil.ReadFile("config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := godns.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(committed, schema) {
+		t.Error("config.schema.json is out of date, update it with the output of godns schema")
+	}
+}
@@ -0,0 +1,263 @@
+package godns
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Redacted replaces the secrets in logs and dumps
+	Redacted = "******"
+
+	// secretCommandTimeout is how long an exec: secret reference may run
+	secretCommandTimeout = 10 * time.Second
+
+	// minSecretLength shorter secrets are not redacted, they would garble
+	// the logs
+	minSecretLength = 4
+)
+
+var (
+	secrets   = map[string]bool{}
+	secretsMu sync.RWMutex
+	// sortedSecrets lists the secrets from the longest, so that a secret
+	// containing another one is redacted whole
+	sortedSecrets []string
+)
+
+// ResolveSecret resolves a secret reference: env:NAME reads an environment
+// variable, file:PATH reads a file, exec:COMMAND runs a command without a
+// shell and reads its output. Other values are returned unchanged.
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+
+	case strings.HasPrefix(value, "file:"):
+		content, err := ioutil.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+
+	case strings.HasPrefix(value, "exec:"):
+		args := strings.Fields(strings.TrimPrefix(value, "exec:"))
+		if len(args) == 0 {
+			return "", errors.New("empty secret command")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("secret command %s failed: %s", args[0], err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+
+	return value, nil
+}
+
+// resolveSecrets resolves the references of every field tagged secret in
+// settings, and registers the secrets for redaction. It only runs from
+// LoadSettings at startup, a rotated secret is read on the next restart.
+func resolveSecrets(settings *Settings) error {
+	return walkSecrets(reflect.ValueOf(settings).Elem(), "", func(path string, value string) (string, error) {
+		secret, err := ResolveSecret(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", path, err)
+		}
+		RegisterSecret(secret)
+		return secret, nil
+	})
+}
+
+// walkSecrets calls fn for every non-empty secret string in v, including
+// the values of secret maps, and sets them to its result
+func walkSecrets(v reflect.Value, path string, fn func(path, value string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+
+			if field.Tag.Get("secret") == "true" {
+				if err := setSecret(v.Field(i), fieldPath, fn); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := walkSecrets(v.Field(i), fieldPath, fn); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := walkSecrets(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// setSecret replaces the secret string, or the values of the secret map, v
+func setSecret(v reflect.Value, path string, fn func(path, value string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.String:
+		if v.String() == "" {
+			return nil
+		}
+		secret, err := fn(path, v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(secret)
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			value := v.MapIndex(key).String()
+			if value == "" {
+				continue
+			}
+			secret, err := fn(path+"."+key.String(), value)
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(key, reflect.ValueOf(secret))
+		}
+	}
+
+	return nil
+}
+
+// RegisterSecret makes secret redacted by Redact, as it is and escaped as
+// in URLs
+func RegisterSecret(secret string) {
+	if len(secret) < minSecretLength {
+		return
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range []string{secret, url.QueryEscape(secret), url.PathEscape(secret)} {
+		if !secrets[s] {
+			secrets[s] = true
+			sortedSecrets = append(sortedSecrets, s)
+		}
+	}
+	sort.SliceStable(sortedSecrets, func(i, j int) bool { return len(sortedSecrets[i]) > len(sortedSecrets[j]) })
+}
+
+// RegisterBasicAuth makes the Authorization header of user and password
+// redacted by Redact, along with password
+func RegisterBasicAuth(user, password string) {
+	RegisterSecret(password)
+	if password != "" {
+		RegisterSecret(base64.StdEncoding.EncodeToString([]byte(user + ":" + password)))
+	}
+}
+
+// RegisterSecrets registers every field tagged secret in settings, for
+// the settings which are not read by LoadSettings
+func RegisterSecrets(settings *Settings) {
+	walkSecrets(reflect.ValueOf(settings).Elem(), "", func(path, value string) (string, error) {
+		RegisterSecret(value)
+		return value, nil
+	})
+}
+
+// Redact replaces the registered secrets in s
+func Redact(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+
+	for _, secret := range sortedSecrets {
+		s = strings.Replace(s, secret, Redacted, -1)
+	}
+	return s
+}
+
+// RedactError returns err with the registered secrets redacted from its
+// message, err itself when it holds none
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if msg := Redact(err.Error()); msg != err.Error() {
+		return errors.New(msg)
+	}
+	return err
+}
+
+// RedactedSettings returns a copy of settings with every secret replaced,
+// for dumps
+func RedactedSettings(settings *Settings) (*Settings, error) {
+	content, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	redacted := new(Settings)
+	if err := json.Unmarshal(content, redacted); err != nil {
+		return nil, err
+	}
+
+	err = walkSecrets(reflect.ValueOf(redacted).Elem(), "", func(string, string) (string, error) {
+		return Redacted, nil
+	})
+	return redacted, err
+}
+
+// redactWriter redacts the secrets written to w
+type redactWriter struct {
+	w io.Writer
+}
+
+// NewRedactWriter returns a writer which redacts the registered secrets
+// before writing to w, such as the output of the log package
+func NewRedactWriter(w io.Writer) io.Writer {
+	return &redactWriter{w: w}
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,71 @@
+package godns
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "token"), []byte("file-secret\n"), 0600)
+	os.Setenv("TEST_GODNS_SECRET", "env-secret")
+	defer os.Unsetenv("TEST_GODNS_SECRET")
+
+	settings := &Settings{
+		Cloudflare: CloudflareSettings{APIToken: "env:TEST_GODNS_SECRET"},
+		Notify:     Notify{Mail: MailNotify{SMTPPassword: "file:" + filepath.Join(dir, "token")}},
+		Server:     ServerSettings{UpdateKeys: map[string]string{"key": "exec:echo exec-secret"}},
+		DynDNS2Server: DynDNS2ServerSettings{
+			Clients: []DynDNS2Client{{Username: "router", Password: "plain-secret"}},
+		},
+		Webhook: WebhookSettings{
+			Headers:       map[string]string{"Content-Type": "application/json"},
+			SecretHeaders: map[string]string{"Authorization": "Bearer header-secret"},
+		},
+	}
+	if err := resolveSecrets(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	if settings.Cloudflare.APIToken != "env-secret" {
+		t.Errorf("env: reference should be resolved, got %q", settings.Cloudflare.APIToken)
+	}
+	if settings.Notify.Mail.SMTPPassword != "file-secret" {
+		t.Errorf("file: reference should be resolved, got %q", settings.Notify.Mail.SMTPPassword)
+	}
+	if settings.Server.UpdateKeys["key"] != "exec-secret" {
+		t.Errorf("exec: reference should be resolved, got %q", settings.Server.UpdateKeys["key"])
+	}
+
+	var buf bytes.Buffer
+	logger := log.New(NewRedactWriter(&buf), "", 0)
+	logger.Println("token env-secret, password plain-secret, user router, Bearer header-secret, application/json")
+	if buf.String() != "token ******, password ******, user router, ******, application/json\n" {
+		t.Errorf("secrets should be redacted from the logs, got %q", buf.String())
+	}
+
+	redacted, err := RedactedSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redacted.Server.UpdateKeys["key"] != Redacted || redacted.DynDNS2Server.Clients[0].Password != Redacted {
+		t.Errorf("secrets should be redacted from the dump, got %+v", redacted)
+	}
+	if settings.Server.UpdateKeys["key"] != "exec-secret" {
+		t.Error("redacting a dump should not change the settings")
+	}
+
+	settings.HE.DDNSKey = "env:TEST_GODNS_MISSING"
+	if err := resolveSecrets(settings); err == nil || err.Error() != "he.ddns_key: environment variable TEST_GODNS_MISSING is not set" {
+		t.Errorf("unresolved reference should fail with its path, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"crypto"
+	"errors"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jmbayu/godns"
+	"github.com/miekg/dns"
+)
+
+const (
+	// signatures are valid from one hour ago, to absorb clock skew
+	signatureInception = time.Hour
+	// signatures are valid for a week, responses are signed on the fly anyway
+	signatureValidity = 7 * 24 * time.Hour
+)
+
+// signer signs the served records online with a single key
+type signer struct {
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+// newSigner loads a key pair generated by dnssec-keygen or ldns-keygen
+func newSigner(conf godns.DNSSECSettings) (*signer, error) {
+	pub, err := os.Open(conf.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer pub.Close()
+
+	rr, err := dns.ReadRR(pub, conf.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return nil, errors.New(conf.KeyFile + " is not a DNSKEY record")
+	}
+
+	private, err := os.Open(conf.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer private.Close()
+
+	priv, err := key.ReadPrivateKey(private, conf.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cs, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, errors.New(conf.PrivateKeyFile + " is not a supported private key")
+	}
+
+	logger.Infof("DNSSEC signing enabled with key %d", key.KeyTag())
+	return &signer{key: key, priv: cs}, nil
+}
+
+// sign returns the signature of an RRset
+func (sg *signer) sign(rrset []dns.RR, zone string) (dns.RR, error) {
+	now := time.Now()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrset[0].Header().Ttl},
+		Algorithm:  sg.key.Algorithm,
+		KeyTag:     sg.key.KeyTag(),
+		SignerName: zone,
+		Inception:  uint32(now.Add(-signatureInception).Unix()),
+		Expiration: uint32(now.Add(signatureValidity).Unix()),
+	}
+
+	if err := sig.Sign(sg.priv, rrset); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// signAll returns the signatures of every RRset of rrs
+func (sg *signer) signAll(rrs []dns.RR, zone string) []dns.RR {
+	var sigs []dns.RR
+	for _, rrset := range splitRRsets(rrs) {
+		sig, err := sg.sign(rrset, zone)
+		if err != nil {
+			logger.Error("Failed to sign RRset:", err)
+			continue
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs
+}
+
+// signMsg signs the answer of m. Negative answers are proven with a
+// minimally covering NSEC record, so a missing name is answered as NODATA
+// (RFC 4470 and the "black lies" technique), which needs no zone-wide chain.
+func (sg *signer) signMsg(m *dns.Msg, zone string, owned []dns.RR, exists bool) {
+	if len(m.Answer) > 0 {
+		m.Answer = append(m.Answer, sg.signAll(m.Answer, zone)...)
+		return
+	}
+
+	name := m.Question[0].Name
+	types := []uint16{dns.TypeRRSIG, dns.TypeNSEC}
+	if exists {
+		seen := map[uint16]bool{}
+		for _, rr := range owned {
+			if t := rr.Header().Rrtype; !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	nsec := &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: m.Ns[0].Header().Ttl},
+		NextDomain: "\\000." + name,
+		TypeBitMap: types,
+	}
+
+	m.Rcode = dns.RcodeSuccess
+	m.Ns = append(m.Ns, nsec)
+	m.Ns = append(m.Ns, sg.signAll(m.Ns, zone)...)
+}
+
+// splitRRsets groups rrs by owner name and type
+func splitRRsets(rrs []dns.RR) [][]dns.RR {
+	type key struct {
+		name  string
+		rtype uint16
+	}
+
+	var order []key
+	sets := map[key][]dns.RR{}
+	for _, rr := range rrs {
+		k := key{rr.Header().Name, rr.Header().Rrtype}
+		if k.rtype == dns.TypeRRSIG {
+			continue
+		}
+		if _, ok := sets[k]; !ok {
+			order = append(order, k)
+		}
+		sets[k] = append(sets[k], rr)
+	}
+
+	var result [][]dns.RR
+	for _, k := range order {
+		result = append(result, sets[k])
+	}
+	return result
+}
@@ -0,0 +1,581 @@
+// Package server is an authoritative DNS server for a dynamic zone
+// based on miekg/dns
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmbayu/godns"
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultTTL is the TTL of the served records when none is configured
+	DefaultTTL = 60
+	// DefaultListen is the address the server listens on when none is configured
+	DefaultListen = ":53"
+)
+
+// transferChunk is the number of records sent in each message of a zone
+// transfer, small enough for a message to stay under 64 KiB
+const transferChunk = 200
+
+// logger logs with the component field
+var logger = godns.WithFields(godns.Fields{"component": "server"})
+
+// Server answers for a single zone, with the addresses detected locally or
+// pushed by remote GoDNS clients through RFC 2136 updates
+type Server struct {
+	Configuration *godns.Settings
+
+	zone    string
+	mu      sync.RWMutex
+	records map[string][]dns.RR
+	serial  uint32
+	signer  *signer
+	servers []*dns.Server
+}
+
+// New creates a server for the zone configured in the server settings
+func New(configuration *godns.Settings) (*Server, error) {
+	conf := configuration.Server
+	if conf.Zone == "" {
+		return nil, errors.New("server zone cannot be empty")
+	}
+
+	s := &Server{
+		Configuration: configuration,
+		zone:          strings.ToLower(dns.Fqdn(conf.Zone)),
+		records:       map[string][]dns.RR{},
+		serial:        uint32(time.Now().Unix()),
+	}
+
+	if conf.DNSSEC.Enabled {
+		signer, err := newSigner(conf.DNSSEC)
+		if err != nil {
+			return nil, err
+		}
+		s.signer = signer
+	}
+
+	if conf.DataPath != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// ListenAndServe serves the zone over UDP and TCP until Shutdown is called
+func (s *Server) ListenAndServe() error {
+	listen := s.Configuration.Server.Listen
+	if listen == "" {
+		listen = DefaultListen
+	}
+
+	pc, err := net.ListenPacket("udp", listen)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		pc.Close()
+		return err
+	}
+
+	logger.Infof("Serving zone %s on %s", s.zone, listen)
+	return s.Serve(pc, l)
+}
+
+// Serve serves the zone on the given UDP and TCP listeners until Shutdown is called
+func (s *Server) Serve(pc net.PacketConn, l net.Listener) error {
+	keys := map[string]string{}
+	for name, secret := range s.Configuration.Server.UpdateKeys {
+		keys[dns.Fqdn(name)] = secret
+	}
+
+	errChan := make(chan error, 2)
+	udp := &dns.Server{PacketConn: pc, Handler: s, TsigSecret: keys, MsgAcceptFunc: acceptFunc}
+	tcp := &dns.Server{Listener: l, Handler: s, TsigSecret: keys, MsgAcceptFunc: acceptFunc}
+	s.servers = []*dns.Server{udp, tcp}
+
+	go func() {
+		errChan <- udp.ActivateAndServe()
+	}()
+	go func() {
+		errChan <- tcp.ActivateAndServe()
+	}()
+
+	return <-errChan
+}
+
+// Shutdown stops the server
+func (s *Server) Shutdown() {
+	for _, server := range s.servers {
+		server.Shutdown()
+	}
+}
+
+// RefreshLoop keeps the configured names pointing to the current IP of this host
+func (s *Server) RefreshLoop() {
+	if len(s.Configuration.Server.Names) == 0 {
+		return
+	}
+
+	for {
+		currentIP, err := godns.GetCurrentIP(s.Configuration)
+		if err != nil {
+			logger.Error("get_currentIP:", err)
+		} else {
+			for _, name := range s.Configuration.Server.Names {
+				if err := s.SetAddress(name, currentIP); err != nil {
+					logger.Error("Failed to set address:", err)
+				}
+			}
+		}
+
+		time.Sleep(time.Second * time.Duration(s.Configuration.Interval))
+	}
+}
+
+// SetAddress points name, relative to the zone, to ip
+func (s *Server) SetAddress(name, ip string) error {
+	owner := s.zone
+	if name != "" && name != "@" {
+		owner = strings.ToLower(dns.Fqdn(name + "." + s.zone))
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return fmt.Errorf("invalid IP address %q", ip)
+	}
+
+	var rr dns.RR
+	hdr := dns.RR_Header{Name: owner, Class: dns.ClassINET, Ttl: s.ttl()}
+	if addr.To4() != nil {
+		hdr.Rrtype = dns.TypeA
+		rr = &dns.A{Hdr: hdr, A: addr.To4()}
+	} else {
+		hdr.Rrtype = dns.TypeAAAA
+		rr = &dns.AAAA{Hdr: hdr, AAAA: addr}
+	}
+
+	s.mu.Lock()
+	var current []dns.RR
+	for _, existing := range s.records[owner] {
+		if existing.Header().Rrtype == hdr.Rrtype {
+			current = append(current, existing)
+		}
+	}
+	if len(current) == 1 && sameData(current[0], rr) {
+		s.mu.Unlock()
+		return nil
+	}
+	s.apply([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: owner, Rrtype: hdr.Rrtype, Class: dns.ClassANY}}, rr})
+	s.mu.Unlock()
+
+	logger.Infof("Record updated: %s %s", owner, ip)
+	s.changed()
+	return nil
+}
+
+// ServeDNS implements dns.Handler
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	var m *dns.Msg
+
+	switch {
+	case len(r.Question) != 1:
+		m = new(dns.Msg)
+		m.SetRcode(r, dns.RcodeFormatError)
+	case r.Opcode == dns.OpcodeUpdate:
+		m = s.update(w, r)
+	case r.Question[0].Qtype == dns.TypeAXFR || r.Question[0].Qtype == dns.TypeIXFR:
+		if s.transfer(w, r) {
+			return
+		}
+		m = new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+	default:
+		m = s.query(r)
+	}
+
+	if tsig := r.IsTsig(); tsig != nil && w.TsigStatus() == nil {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+
+	if err := w.WriteMsg(m); err != nil {
+		logger.Error("Failed to write response:", err)
+	}
+}
+
+// query answers a standard query
+func (s *Server) query(r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+	if !dns.IsSubDomain(s.zone, name) {
+		m.Rcode = dns.RcodeRefused
+		m.Authoritative = false
+		return m
+	}
+
+	do := false
+	if opt := r.IsEdns0(); opt != nil {
+		do = opt.Do()
+		m.SetEdns0(4096, do)
+	}
+
+	s.mu.RLock()
+	rrs, exists := s.lookup(name)
+	soa := s.soa()
+	s.mu.RUnlock()
+
+	for _, rr := range rrs {
+		if q.Qtype == dns.TypeANY || rr.Header().Rrtype == q.Qtype {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+
+	if len(m.Answer) == 0 {
+		m.Ns = []dns.RR{soa}
+		if !exists {
+			m.Rcode = dns.RcodeNameError
+		}
+	}
+
+	if do && s.signer != nil {
+		s.signer.signMsg(m, s.zone, rrs, exists)
+	}
+
+	return m
+}
+
+// lookup returns the records owned by name, must be called with the lock held
+func (s *Server) lookup(name string) ([]dns.RR, bool) {
+	rrs := s.records[name]
+	if name != s.zone {
+		return rrs, len(rrs) > 0
+	}
+
+	apex := []dns.RR{s.soa()}
+	apex = append(apex, s.ns()...)
+	if s.signer != nil {
+		apex = append(apex, s.signer.key)
+	}
+	return append(apex, rrs...), true
+}
+
+// update applies an RFC 2136 update signed with one of the update keys
+func (s *Server) update(w dns.ResponseWriter, r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	if len(s.Configuration.Server.UpdateKeys) == 0 {
+		m.Rcode = dns.RcodeRefused
+		return m
+	}
+	if r.IsTsig() == nil || w.TsigStatus() != nil {
+		logger.Warn("Rejected unsigned or badly signed update from", w.RemoteAddr())
+		m.Rcode = dns.RcodeNotAuth
+		return m
+	}
+	if strings.ToLower(dns.Fqdn(r.Question[0].Name)) != s.zone {
+		m.Rcode = dns.RcodeNotZone
+		return m
+	}
+	if len(r.Answer) > 0 {
+		// prerequisites are not supported
+		m.Rcode = dns.RcodeNotImplemented
+		return m
+	}
+
+	for _, rr := range r.Ns {
+		h := rr.Header()
+		name := strings.ToLower(h.Name)
+		if !dns.IsSubDomain(s.zone, name) {
+			m.Rcode = dns.RcodeNotZone
+			return m
+		}
+		if name == s.zone || (h.Rrtype != dns.TypeA && h.Rrtype != dns.TypeAAAA && h.Rrtype != dns.TypeANY) {
+			m.Rcode = dns.RcodeRefused
+			return m
+		}
+	}
+
+	s.mu.Lock()
+	s.apply(r.Ns)
+	s.mu.Unlock()
+
+	logger.Infof("Zone %s updated by %s", s.zone, r.IsTsig().Hdr.Name)
+	s.changed()
+	return m
+}
+
+// apply applies the update section rrs, see RFC 2136 section 3.4.2.
+// It must be called with the lock held.
+func (s *Server) apply(rrs []dns.RR) {
+	for _, rr := range rrs {
+		h := rr.Header()
+		name := strings.ToLower(h.Name)
+
+		var kept []dns.RR
+		for _, existing := range s.records[name] {
+			switch h.Class {
+			case dns.ClassANY:
+				if h.Rrtype == dns.TypeANY || existing.Header().Rrtype == h.Rrtype {
+					continue
+				}
+			case dns.ClassNONE:
+				if sameData(existing, rr) {
+					continue
+				}
+			case dns.ClassINET:
+				if sameData(existing, rr) {
+					continue
+				}
+			}
+			kept = append(kept, existing)
+		}
+
+		if h.Class == dns.ClassINET {
+			rr = dns.Copy(rr)
+			rr.Header().Name = name
+			if rr.Header().Ttl == 0 {
+				rr.Header().Ttl = s.ttl()
+			}
+			kept = append(kept, rr)
+		}
+
+		if len(kept) == 0 {
+			delete(s.records, name)
+		} else {
+			s.records[name] = kept
+		}
+	}
+	s.serial++
+}
+
+// changed persists the zone and notifies the secondaries
+func (s *Server) changed() {
+	if err := s.save(); err != nil {
+		logger.Error("Failed to save zone data:", err)
+	}
+
+	for _, secondary := range s.Configuration.Server.AlsoNotify {
+		go s.notify(secondary)
+	}
+}
+
+func (s *Server) notify(secondary string) {
+	if _, _, err := net.SplitHostPort(secondary); err != nil {
+		secondary = net.JoinHostPort(secondary, "53")
+	}
+
+	m := new(dns.Msg)
+	m.SetNotify(s.zone)
+	if _, err := dns.Exchange(m, secondary); err != nil {
+		logger.Errorf("Failed to notify %s: %s", secondary, err)
+	}
+}
+
+// transfer sends the zone to an allowed secondary, it returns false if the
+// transfer is refused
+func (s *Server) transfer(w dns.ResponseWriter, r *dns.Msg) bool {
+	if w.LocalAddr().Network() != "tcp" || strings.ToLower(r.Question[0].Name) != s.zone || !s.transferAllowed(w, r) {
+		return false
+	}
+
+	s.mu.RLock()
+	soa := s.soa()
+	rrs := []dns.RR{soa}
+	rrs = append(rrs, s.ns()...)
+	if s.signer != nil {
+		rrs = append(rrs, s.signer.key)
+	}
+	for _, records := range s.records {
+		rrs = append(rrs, records...)
+	}
+	s.mu.RUnlock()
+
+	if s.signer != nil {
+		rrs = append(rrs, s.signer.signAll(rrs, s.zone)...)
+	}
+	rrs = append(rrs, soa)
+
+	// The connection is ours once hijacked, it is closed after the transfer
+	w.Hijack()
+	defer w.Close()
+
+	ch := make(chan *dns.Envelope, (len(rrs)+transferChunk-1)/transferChunk)
+	for len(rrs) > transferChunk {
+		ch <- &dns.Envelope{RR: rrs[:transferChunk]}
+		rrs = rrs[transferChunk:]
+	}
+	ch <- &dns.Envelope{RR: rrs}
+	close(ch)
+
+	if err := new(dns.Transfer).Out(w, r, ch); err != nil {
+		logger.Error("Zone transfer failed:", err)
+		return true
+	}
+
+	logger.Infof("Zone %s transferred to %s", s.zone, w.RemoteAddr())
+	return true
+}
+
+func (s *Server) transferAllowed(w dns.ResponseWriter, r *dns.Msg) bool {
+	if r.IsTsig() != nil && w.TsigStatus() == nil {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(w.RemoteAddr().String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+
+	for _, allowed := range s.Configuration.Server.AllowTransfer {
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// soa must be called with the lock held
+func (s *Server) soa() dns.RR {
+	conf := s.Configuration.Server
+
+	ns := s.zone
+	if len(conf.NameServers) > 0 {
+		ns = dns.Fqdn(conf.NameServers[0])
+	}
+
+	mbox := conf.Hostmaster
+	if mbox == "" {
+		mbox = "hostmaster." + s.zone
+	}
+	mbox = dns.Fqdn(strings.Replace(mbox, "@", ".", 1))
+
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: s.zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: s.ttl()},
+		Ns:      ns,
+		Mbox:    mbox,
+		Serial:  s.serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  604800,
+		Minttl:  s.ttl(),
+	}
+}
+
+func (s *Server) ns() []dns.RR {
+	var rrs []dns.RR
+	for _, ns := range s.Configuration.Server.NameServers {
+		rrs = append(rrs, &dns.NS{
+			Hdr: dns.RR_Header{Name: s.zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 3600},
+			Ns:  dns.Fqdn(ns),
+		})
+	}
+	return rrs
+}
+
+func (s *Server) ttl() uint32 {
+	if s.Configuration.Server.TTL > 0 {
+		return uint32(s.Configuration.Server.TTL)
+	}
+	return DefaultTTL
+}
+
+// load reads the zone data saved by a previous run
+func (s *Server) load() error {
+	content, err := ioutil.ReadFile(s.Configuration.Server.DataPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var data map[string][]string
+	if err := json.Unmarshal(content, &data); err != nil {
+		return err
+	}
+
+	for name, records := range data {
+		for _, record := range records {
+			rr, err := dns.NewRR(record)
+			if err != nil {
+				return err
+			}
+			s.records[name] = append(s.records[name], rr)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) save() error {
+	if s.Configuration.Server.DataPath == "" {
+		return nil
+	}
+
+	s.mu.RLock()
+	data := map[string][]string{}
+	for name, records := range s.records {
+		for _, rr := range records {
+			data[name] = append(data[name], rr.String())
+		}
+	}
+	s.mu.RUnlock()
+
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.Configuration.Server.DataPath, content, 0600)
+}
+
+func sameData(a, b dns.RR) bool {
+	if a.Header().Rrtype != b.Header().Rrtype {
+		return false
+	}
+
+	switch t := a.(type) {
+	case *dns.A:
+		return t.A.Equal(b.(*dns.A).A)
+	case *dns.AAAA:
+		return t.AAAA.Equal(b.(*dns.AAAA).AAAA)
+	}
+
+	return false
+}
+
+// acceptFunc accepts dynamic updates on top of the default messages
+func acceptFunc(dh dns.Header) dns.MsgAcceptAction {
+	if opcode := int(dh.Bits>>11) & 0xF; opcode == dns.OpcodeUpdate {
+		if dh.Bits&(1<<15) != 0 || dh.Qdcount != 1 {
+			return dns.MsgIgnore
+		}
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
+}
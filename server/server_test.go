@@ -0,0 +1,247 @@
+package server
+
+import (
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmbayu/godns"
+	"github.com/jmbayu/godns/handler/rfc2136"
+	"github.com/miekg/dns"
+)
+
+const testSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+
+func startServer(t *testing.T, conf godns.ServerSettings) (*Server, string) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(&godns.Settings{Server: conf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(pc, l)
+
+	addr := pc.LocalAddr().String()
+	for i := 0; i < 50; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion("dyn.example.com.", dns.TypeSOA)
+		if _, err := dns.Exchange(m, addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return s, addr
+}
+
+func testSettings() godns.ServerSettings {
+	return godns.ServerSettings{
+		Zone:          "dyn.example.com",
+		NameServers:   []string{"ns1.example.com"},
+		UpdateKeys:    map[string]string{"godns-key": testSecret},
+		AllowTransfer: []string{"127.0.0.0/8"},
+	}
+}
+
+func query(t *testing.T, addr, name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	in, err := dns.Exchange(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return in
+}
+
+func TestServeLocalAddress(t *testing.T) {
+	s, addr := startServer(t, testSettings())
+	defer s.Shutdown()
+
+	if err := s.SetAddress("home", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	in := query(t, addr, "home.dyn.example.com.", dns.TypeA)
+	if len(in.Answer) != 1 || in.Answer[0].(*dns.A).A.String() != "192.0.2.1" {
+		t.Errorf("home.dyn.example.com should resolve to 192.0.2.1, got %v", in.Answer)
+	}
+	if in.Answer[0].Header().Ttl != DefaultTTL {
+		t.Errorf("TTL should be %d, got %d", DefaultTTL, in.Answer[0].Header().Ttl)
+	}
+
+	in = query(t, addr, "missing.dyn.example.com.", dns.TypeA)
+	if in.Rcode != dns.RcodeNameError || len(in.Ns) != 1 {
+		t.Errorf("missing name should be NXDOMAIN with SOA, got %v", in)
+	}
+
+	in = query(t, addr, "www.example.org.", dns.TypeA)
+	if in.Rcode != dns.RcodeRefused {
+		t.Errorf("names outside of the zone should be refused, got %s", dns.RcodeToString[in.Rcode])
+	}
+}
+
+func TestServeRemoteUpdate(t *testing.T) {
+	s, addr := startServer(t, testSettings())
+	defer s.Shutdown()
+
+	client := &rfc2136.Handler{}
+	client.SetConfiguration(&godns.Settings{
+		IPType: godns.IPV4,
+		RFC2136: godns.RFC2136Settings{
+			Server:  addr,
+			Zone:    "dyn.example.com",
+			KeyName: "godns-key",
+			Secret:  testSecret,
+		},
+	})
+
+	if err := client.UpdateIP("dyn.example.com", "office", "192.0.2.10", ""); err != nil {
+		t.Fatal(err)
+	}
+	if ip, err := client.Query("office.dyn.example.com"); err != nil || ip != "192.0.2.10" {
+		t.Errorf("office.dyn.example.com should resolve to 192.0.2.10, got %s (%v)", ip, err)
+	}
+
+	client.Configuration.RFC2136.KeyName = ""
+	if err := client.UpdateIP("dyn.example.com", "office", "192.0.2.11", ""); err == nil {
+		t.Error("unsigned update should be rejected")
+	}
+}
+
+func TestServeTransfer(t *testing.T) {
+	s, addr := startServer(t, testSettings())
+	defer s.Shutdown()
+
+	s.SetAddress("home", "192.0.2.1")
+	s.SetAddress("home", "2001:db8::1")
+
+	m := new(dns.Msg)
+	m.SetAxfr("dyn.example.com.")
+	env, err := new(dns.Transfer).In(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rrs []dns.RR
+	for e := range env {
+		if e.Error != nil {
+			t.Fatal(e.Error)
+		}
+		rrs = append(rrs, e.RR...)
+	}
+
+	// SOA, NS, A, AAAA, SOA
+	if len(rrs) != 5 {
+		t.Errorf("transfer should contain 5 records, got %v", rrs)
+	}
+}
+
+func TestServeLargeTransfer(t *testing.T) {
+	s, addr := startServer(t, testSettings())
+	defer s.Shutdown()
+
+	// About 40 bytes per record, well over 64 KiB for the whole zone
+	const hosts = 3000
+	for i := 0; i < hosts; i++ {
+		s.SetAddress(fmt.Sprintf("host%d", i), fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+	}
+
+	m := new(dns.Msg)
+	m.SetAxfr("dyn.example.com.")
+	env, err := new(dns.Transfer).In(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rrs []dns.RR
+	for e := range env {
+		if e.Error != nil {
+			t.Fatal(e.Error)
+		}
+		rrs = append(rrs, e.RR...)
+	}
+
+	// SOA, NS, the A records, SOA
+	if len(rrs) != hosts+3 {
+		t.Errorf("transfer should contain %d records, got %d", hosts+3, len(rrs))
+	}
+}
+
+func TestServeDNSSEC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "dyn.example.com.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := testSettings()
+	conf.DNSSEC = godns.DNSSECSettings{
+		Enabled:        true,
+		KeyFile:        filepath.Join(dir, "zone.key"),
+		PrivateKeyFile: filepath.Join(dir, "zone.private"),
+	}
+	ioutil.WriteFile(conf.DNSSEC.KeyFile, []byte(key.String()), 0600)
+	ioutil.WriteFile(conf.DNSSEC.PrivateKeyFile, []byte(key.PrivateKeyString(priv.(crypto.PrivateKey))), 0600)
+
+	s, addr := startServer(t, conf)
+	defer s.Shutdown()
+	s.SetAddress("home", "192.0.2.1")
+
+	m := new(dns.Msg)
+	m.SetQuestion("home.dyn.example.com.", dns.TypeA)
+	m.SetEdns0(4096, true)
+	in, err := dns.Exchange(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(in.Answer) != 2 {
+		t.Fatalf("answer should contain the A record and its signature, got %v", in.Answer)
+	}
+	sig, ok := in.Answer[1].(*dns.RRSIG)
+	if !ok {
+		t.Fatalf("second answer should be an RRSIG, got %v", in.Answer[1])
+	}
+	if err := sig.Verify(key, in.Answer[:1]); err != nil {
+		t.Errorf("signature should be valid: %s", err)
+	}
+
+	m.SetQuestion("missing.dyn.example.com.", dns.TypeA)
+	in, err = dns.Exchange(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		t.Errorf("signed negative answers should be NODATA, got %s", dns.RcodeToString[in.Rcode])
+	}
+	foundNSEC := false
+	for _, rr := range in.Ns {
+		if _, ok := rr.(*dns.NSEC); ok {
+			foundNSEC = true
+		}
+	}
+	if !foundNSEC {
+		t.Error("negative answer should be proven with an NSEC record")
+	}
+}
@@ -0,0 +1,110 @@
+package godns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordState is the last known state of a record managed by GoDNS
+type RecordState struct {
+	IP           string       `json:"ip"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	Verification VerifyResult `json:"verification,omitempty"`
+	VerifiedAt   time.Time    `json:"verified_at,omitempty"`
+}
+
+// StateStore keeps the RecordState of every hostname, persisted to a JSON file
+// when a path is given
+type StateStore struct {
+	path    string
+	mu      sync.Mutex
+	records map[string]RecordState
+}
+
+var (
+	stores   = map[string]*StateStore{}
+	storesMu sync.Mutex
+)
+
+// GetStateStore returns the state store configured by state_path.
+// Stores are shared, so every handler sees the same records.
+func GetStateStore(configuration *Settings) *StateStore {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	if store, ok := stores[configuration.StatePath]; ok {
+		return store
+	}
+
+	store := &StateStore{path: configuration.StatePath, records: map[string]RecordState{}}
+	if store.path != "" {
+		if err := store.load(); err != nil {
+			Error("Failed to load state file:", err)
+		}
+	}
+	stores[configuration.StatePath] = store
+
+	return store
+}
+
+// Get returns the state of hostname
+func (s *StateStore) Get(hostname string) (RecordState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.records[hostname]
+	return state, ok
+}
+
+// SetIP records that hostname has been updated to ip
+func (s *StateStore) SetIP(hostname, ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[hostname] = RecordState{IP: ip, UpdatedAt: time.Now()}
+	s.save()
+}
+
+// SetVerification records the outcome of the verification of hostname
+func (s *StateStore) SetVerification(hostname string, result VerifyResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.records[hostname]
+	state.Verification = result
+	state.VerifiedAt = time.Now()
+	s.records[hostname] = state
+	s.save()
+}
+
+func (s *StateStore) load() error {
+	content, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, &s.records)
+}
+
+// save must be called with the lock held
+func (s *StateStore) save() {
+	if s.path == "" {
+		return
+	}
+
+	content, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		Error("Failed to encode state:", err)
+		return
+	}
+
+	if err := ioutil.WriteFile(s.path, content, 0600); err != nil {
+		Error("Failed to write state file:", err)
+	}
+}
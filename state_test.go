@@ -0,0 +1,34 @@
+package godns
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := &Settings{StatePath: filepath.Join(dir, "state.json")}
+	store := GetStateStore(conf)
+	store.SetIP("www.example.com", "1.2.3.4")
+	store.SetVerification("www.example.com", Verified)
+
+	// drop the cached store to force a reload from disk
+	storesMu.Lock()
+	delete(stores, conf.StatePath)
+	storesMu.Unlock()
+
+	state, ok := GetStateStore(conf).Get("www.example.com")
+	if !ok {
+		t.Fatal("state of www.example.com should be persisted")
+	}
+	if state.IP != "1.2.3.4" || state.Verification != Verified {
+		t.Errorf("unexpected state: %+v", state)
+	}
+}
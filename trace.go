@@ -0,0 +1,315 @@
+package godns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceLog sends the HTTP traces to the log, any other destination of
+// TraceHTTP is a HAR file
+const TraceLog = "log"
+
+// maxTraceBody is the size of the bodies kept in the traces
+const maxTraceBody = 64 * 1024
+
+// maxHAREntries is the number of requests kept in the HAR file, the oldest
+// ones are dropped so that a long running GoDNS does not grow it forever
+var maxHAREntries = 1000
+
+// maskedHeaders are replaced whole in the traces, whatever their value
+var maskedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Auth-Key":          true,
+	"X-Auth-Token":        true,
+}
+
+var (
+	tracer   *httpTracer
+	tracerMu sync.RWMutex
+)
+
+// TraceHTTP records the requests of the clients of GetHttpClient, with
+// their responses, to the log when destination is TraceLog or to the HAR
+// file destination. Secrets are redacted from the traces.
+func TraceHTTP(destination string) error {
+	t := &httpTracer{destination: destination}
+	if destination != TraceLog {
+		// fail now rather than on the first request
+		if err := t.writeHAR(); err != nil {
+			return err
+		}
+	}
+
+	tracerMu.Lock()
+	tracer = t
+	tracerMu.Unlock()
+	return nil
+}
+
+// traceTransport returns next, traced once TraceHTTP is called; next is
+// http.DefaultTransport when nil
+func traceTransport(next http.RoundTripper) http.RoundTripper {
+	return &tracingTransport{next: next}
+}
+
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	tracerMu.RLock()
+	tracer := tracer
+	tracerMu.RUnlock()
+	if tracer == nil {
+		return next.RoundTrip(req)
+	}
+
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	started := time.Now()
+	resp, err := next.RoundTrip(req)
+	elapsed := time.Since(started)
+
+	var respBody []byte
+	if resp != nil && resp.Body != nil {
+		var readErr error
+		respBody, readErr = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+		if readErr != nil && err == nil {
+			err = readErr
+		}
+	}
+
+	tracer.record(req, reqBody, resp, respBody, err, started, elapsed)
+	return resp, err
+}
+
+// httpTracer writes the traces, and keeps the last entries of the HAR file
+// in a ring
+type httpTracer struct {
+	mu          sync.Mutex
+	destination string
+	entries     []harEntry
+	// next is the oldest entry, replaced by the next one once the ring is
+	// full
+	next int
+}
+
+func (t *httpTracer) record(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, err error, started time.Time, elapsed time.Duration) {
+	entry := harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            float64(elapsed) / float64(time.Millisecond),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         Redact(req.URL.String()),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(req.Header),
+			QueryString: []harNameValue{},
+			Cookies:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Response: harResponse{
+			Headers:     []harNameValue{},
+			Cookies:     []harNameValue{},
+			Content:     harContent{Size: len(respBody), Text: traceBody(respBody)},
+			HeadersSize: -1,
+			BodySize:    len(respBody),
+		},
+		Cache:   struct{}{},
+		Timings: harTimings{Send: 0, Wait: float64(elapsed) / float64(time.Millisecond), Receive: 0},
+	}
+	if entry.Request.HTTPVersion == "" {
+		entry.Request.HTTPVersion = "HTTP/1.1"
+	}
+	for key, values := range req.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: key, Value: Redact(value)})
+		}
+	}
+	sort.Slice(entry.Request.QueryString, func(i, j int) bool { return entry.Request.QueryString[i].Name < entry.Request.QueryString[j].Name })
+	if len(reqBody) > 0 {
+		entry.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: traceBody(reqBody)}
+	}
+	if resp != nil {
+		entry.Response.Status = resp.StatusCode
+		entry.Response.StatusText = strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode)))
+		entry.Response.HTTPVersion = resp.Proto
+		entry.Response.Headers = harHeaders(resp.Header)
+		entry.Response.Content.MimeType = resp.Header.Get("Content-Type")
+		entry.Response.RedirectURL = Redact(resp.Header.Get("Location"))
+	}
+	if err != nil {
+		entry.Error = Redact(err.Error())
+	}
+
+	if t.destination == TraceLog {
+		t.log(&entry)
+		return
+	}
+
+	t.mu.Lock()
+	if len(t.entries) < maxHAREntries {
+		t.entries = append(t.entries, entry)
+	} else {
+		t.entries[t.next] = entry
+		t.next = (t.next + 1) % len(t.entries)
+	}
+	t.mu.Unlock()
+	if err := t.writeHAR(); err != nil {
+		Error("Failed to write the HTTP trace:", err)
+	}
+}
+
+func (t *httpTracer) log(entry *harEntry) {
+	result := fmt.Sprintf("%d %s", entry.Response.Status, entry.Response.StatusText)
+	if entry.Error != "" {
+		result = "failed: " + entry.Error
+	}
+
+	fields := Fields{
+		"trace":            "http",
+		"request_headers":  headerString(entry.Request.Headers),
+		"response_headers": headerString(entry.Response.Headers),
+	}
+	if entry.Request.PostData != nil {
+		fields["request_body"] = entry.Request.PostData.Text
+	}
+	if entry.Response.Content.Text != "" {
+		fields["response_body"] = entry.Response.Content.Text
+	}
+	WithFields(fields).Infof("HTTP %s %s %s in %.0fms", entry.Request.Method, entry.Request.URL, result, entry.Time)
+}
+
+// writeHAR rewrites the whole HAR file, so that it is valid whenever GoDNS
+// is stopped, with the entries from the oldest
+func (t *httpTracer) writeHAR() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := append([]harEntry{}, t.entries[t.next:]...)
+	har := map[string]interface{}{
+		"log": map[string]interface{}{
+			"version": "1.2",
+			"creator": map[string]string{"name": "GoDNS", "version": "1"},
+			"entries": append(entries, t.entries[:t.next]...),
+		},
+	}
+	content, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(t.destination, content, 0600)
+}
+
+// traceBody returns the redacted body, truncated to maxTraceBody
+func traceBody(body []byte) string {
+	if len(body) > maxTraceBody {
+		return Redact(string(body[:maxTraceBody])) + "...(truncated)"
+	}
+	return Redact(string(body))
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	list := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			if maskedHeaders[http.CanonicalHeaderKey(name)] {
+				value = Redacted
+			}
+			list = append(list, harNameValue{Name: name, Value: Redact(value)})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func headerString(headers []harNameValue) string {
+	var list []string
+	for _, header := range headers {
+		list = append(list, header.Name+": "+header.Value)
+	}
+	return strings.Join(list, ", ")
+}
+
+// The HAR 1.2 format, see http://www.softwareishard.com/blog/har-12-spec/
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
@@ -0,0 +1,130 @@
+package godns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTraceHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `{"echo": %q}`, body)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "godns-trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "trace.har")
+	if err := TraceHTTP(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { tracer = nil }()
+
+	RegisterSecret("trace-secret")
+	req, _ := http.NewRequest("POST", server.URL+"/update?token=trace-secret", strings.NewReader(`{"key": "trace-secret"}`))
+	req.Header.Set("Authorization", "Bearer something")
+	resp, err := GetHttpClient(&Settings{}, false).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "trace-secret") {
+		t.Errorf("the response body should be left to the caller, got %q", body)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "trace-secret") || strings.Contains(string(content), "something") {
+		t.Errorf("secrets leaked in the trace: %s", content)
+	}
+
+	var har struct {
+		Log struct {
+			Entries []harEntry `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(content, &har); err != nil {
+		t.Fatal(err)
+	}
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(har.Log.Entries))
+	}
+	entry := har.Log.Entries[0]
+	if entry.Request.Method != "POST" || entry.Request.URL != server.URL+"/update?token="+Redacted {
+		t.Errorf("unexpected request %+v", entry.Request)
+	}
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != `{"key": "`+Redacted+`"}` {
+		t.Errorf("unexpected request body %+v", entry.Request.PostData)
+	}
+	if entry.Response.Status != http.StatusForbidden || entry.Response.StatusText != "Forbidden" {
+		t.Errorf("unexpected response %+v", entry.Response)
+	}
+	if !strings.Contains(entry.Response.Content.Text, Redacted) {
+		t.Errorf("the response body should be traced, got %q", entry.Response.Content.Text)
+	}
+}
+
+func TestTraceHARRing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "godns-trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(max int) { maxHAREntries = max }(maxHAREntries)
+	maxHAREntries = 3
+
+	path := filepath.Join(dir, "trace.har")
+	if err := TraceHTTP(path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { tracer = nil }()
+
+	for i := 0; i < 5; i++ {
+		resp, err := GetHttpClient(&Settings{}, false).Get(fmt.Sprintf("%s/%d", server.URL, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har struct {
+		Log struct {
+			Entries []harEntry `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(content, &har); err != nil {
+		t.Fatal(err)
+	}
+
+	var urls []string
+	for _, entry := range har.Log.Entries {
+		urls = append(urls, strings.TrimPrefix(entry.Request.URL, server.URL))
+	}
+	if strings.Join(urls, ",") != "/2,/3,/4" {
+		t.Errorf("the last 3 requests should be kept from the oldest, got %v", urls)
+	}
+}
@@ -3,12 +3,12 @@ package godns
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"io/ioutil"
-	"log"
 	"net"
 	"net/http"
 	"net/url"
@@ -20,7 +20,6 @@ import (
 
 	influxdb2 "github.com/influxdata/influxdb-client-go"
 	"github.com/miekg/dns"
-	"golang.org/x/net/proxy"
 	"gopkg.in/gomail.v2"
 )
 
@@ -60,6 +59,14 @@ const (
 	DREAMHOST = "Dreamhost"
 	// NOIP for NoIP
 	NOIP = "NoIP"
+	// DYNDNS2 for any dyndns2 compatible provider
+	DYNDNS2 = "DynDNS2"
+	// WEBHOOK for any HTTP API, described by templates
+	WEBHOOK = "Webhook"
+	// PLUGIN for out-of-process provider plugins
+	PLUGIN = "Plugin"
+	// RFC2136 for RFC 2136 dynamic updates
+	RFC2136 = "RFC2136"
 	// IPV4 for IPV4 mode
 	IPV4 = "IPV4"
 	// IPV6 for IPV6 mode
@@ -70,13 +77,13 @@ const (
 func GetIPFromInterface(configuration *Settings) (string, error) {
 	ifaces, err := net.InterfaceByName(configuration.IPInterface)
 	if err != nil {
-		log.Println("can't get network device "+configuration.IPInterface+":", err)
+		Error("can't get network device "+configuration.IPInterface+":", err)
 		return "", err
 	}
 
 	addrs, err := ifaces.Addrs()
 	if err != nil {
-		log.Println("can't get address from "+configuration.IPInterface+":", err)
+		Error("can't get address from "+configuration.IPInterface+":", err)
 		return "", err
 	}
 
@@ -123,26 +130,6 @@ func isIPv4(ip string) bool {
 	return strings.Count(ip, ":") < 2
 }
 
-// GetHttpClient creates the HTTP client and return it
-func GetHttpClient(configuration *Settings, useProxy bool) *http.Client {
-	client := &http.Client{}
-
-	if useProxy && configuration.Socks5Proxy != "" {
-		log.Println("use socks5 proxy:" + configuration.Socks5Proxy)
-		dialer, err := proxy.SOCKS5("tcp", configuration.Socks5Proxy, nil, proxy.Direct)
-		if err != nil {
-			log.Println("can't connect to the proxy:", err)
-			return nil
-		}
-
-		httpTransport := &http.Transport{}
-		client.Transport = httpTransport
-		httpTransport.Dial = dialer.Dial
-	}
-
-	return client
-}
-
 //GetCurrentIP gets an IP from either internet or specific interface, depending on configuration
 func GetCurrentIP(configuration *Settings) (string, error) {
 	var err error
@@ -150,7 +137,7 @@ func GetCurrentIP(configuration *Settings) (string, error) {
 	if configuration.IPUrl != "" || configuration.IPV6Url != "" {
 		ip, err := GetIPOnline(configuration)
 		if err != nil {
-			log.Println("get ip online failed. Fallback to get ip from interface if possible.")
+			Warn("get ip online failed. Fallback to get ip from interface if possible.")
 		} else {
 			return ip, nil
 		}
@@ -159,7 +146,7 @@ func GetCurrentIP(configuration *Settings) (string, error) {
 	if configuration.IPInterface != "" {
 		ip, err := GetIPFromInterface(configuration)
 		if err != nil {
-			log.Println("get ip from interface failed. There is no more ways to try.")
+			Error("get ip from interface failed. There is no more ways to try.")
 		} else {
 			return ip, nil
 		}
@@ -168,9 +155,10 @@ func GetCurrentIP(configuration *Settings) (string, error) {
 	return "", err
 }
 
-// GetIPOnline gets public IP from internet
+// GetIPOnline gets public IP from internet, never through the proxy which
+// would return its own IP
 func GetIPOnline(configuration *Settings) (string, error) {
-	client := &http.Client{}
+	client := GetHttpClient(configuration, false)
 
 	var response *http.Response
 	var err error
@@ -182,7 +170,7 @@ func GetIPOnline(configuration *Settings) (string, error) {
 	}
 
 	if err != nil {
-		log.Println("Cannot get IP...")
+		Error("Cannot get IP...")
 		return "", err
 	}
 
@@ -192,57 +180,85 @@ func GetIPOnline(configuration *Settings) (string, error) {
 	return strings.Trim(string(body), "\n"), nil
 }
 
-// CheckSettings check the format of settings
+// CheckSettings check the format of settings, the returned ConfigErrors
+// lists every problem found
 func CheckSettings(config *Settings) error {
-	switch config.Provider {
-	case DNSPOD:
-		if config.Password == "" && config.LoginToken == "" {
-			return errors.New("password or login token cannot be empty")
-		}
-	case HE:
-		if config.Password == "" {
-			return errors.New("password cannot be empty")
-		}
-	case CLOUDFLARE:
-		if config.LoginToken == "" {
-			if config.Email == "" {
-				return errors.New("email cannot be empty")
-			}
-			if config.Password == "" {
-				return errors.New("password cannot be empty")
-			}
-		}
-	case ALIDNS:
-		if config.Email == "" {
-			return errors.New("email cannot be empty")
-		}
-		if config.Password == "" {
-			return errors.New("password cannot be empty")
-		}
-	case DUCK:
-		if config.LoginToken == "" {
-			return errors.New("login token cannot be empty")
+	migrateCredentials(config)
+
+	var errs ConfigErrors
+	checkProvider(config, &errs)
+	checkDomains(config, &errs)
+	checkIP(config, &errs)
+	checkIPSources(config, &errs)
+	checkLog(config, &errs)
+	checkHTTP(config, &errs)
+	checkOwnership(config, &errs)
+	checkCompareWith(config, &errs)
+	checkNotify(config, &errs)
+	return errs.err()
+}
+
+// CheckServerSettings check the format of the built-in DNS server settings
+func CheckServerSettings(config *Settings) error {
+	conf := config.Server
+	if conf.Zone == "" {
+		return errors.New("server zone cannot be empty")
+	}
+	if len(conf.NameServers) == 0 {
+		return errors.New("server name servers cannot be empty")
+	}
+	for name, secret := range conf.UpdateKeys {
+		if _, err := base64.StdEncoding.DecodeString(secret); err != nil {
+			return fmt.Errorf("secret of update key %s must be base64 encoded", name)
 		}
-	case GOOGLE:
-		fallthrough
-	case NOIP:
-		if config.Email == "" {
-			return errors.New("email cannot be empty")
+	}
+	for _, allowed := range conf.AllowTransfer {
+		if _, _, err := net.ParseCIDR(allowed); err != nil && net.ParseIP(allowed) == nil {
+			return fmt.Errorf("invalid allow_transfer address %s", allowed)
 		}
-		if config.Password == "" {
-			return errors.New("password cannot be empty")
+	}
+	if conf.DNSSEC.Enabled && (conf.DNSSEC.KeyFile == "" || conf.DNSSEC.PrivateKeyFile == "") {
+		return errors.New("dnssec key file and private key file cannot be empty")
+	}
+
+	return nil
+}
+
+// CheckDynDNS2ServerSettings check the format of the inbound dyndns2 server settings
+func CheckDynDNS2ServerSettings(config *Settings) error {
+	conf := config.DynDNS2Server
+	if len(conf.Clients) == 0 {
+		return errors.New("dyndns2 server clients cannot be empty")
+	}
+	for _, client := range conf.Clients {
+		if client.Username == "" || client.Password == "" {
+			return errors.New("username and password of dyndns2 clients cannot be empty")
 		}
-	case DREAMHOST:
-		if config.LoginToken == "" {
-			return errors.New("login token cannot be empty")
+		if len(client.Hostnames) == 0 {
+			return fmt.Errorf("hostnames of dyndns2 client %s cannot be empty", client.Username)
 		}
+	}
+	if (conf.TLSCert == "") != (conf.TLSKey == "") {
+		return errors.New("dyndns2 server tls_cert and tls_key must be set together")
+	}
 
-	default:
-		return errors.New("please provide supported DNS provider: DNSPod/HE/AliDNS/Cloudflare/GoogleDomain/DuckDNS/Dreamhost")
+	return nil
+}
 
+func checkCompareWith(config *Settings, errs *ConfigErrors) {
+	check := func(path string, strategy []string) {
+		for i, source := range strategy {
+			if !ValidCompareSource(source) {
+				errs.add(fmt.Sprintf("%s[%d]", path, i), "invalid compare_with source %q, available values are: %s, %s, %s",
+					source, CompareDNS, CompareProviderAPI, CompareLocalState)
+			}
+		}
 	}
 
-	return nil
+	check("compare_with", config.CompareWith)
+	for i, domain := range config.Domains {
+		check(fmt.Sprintf("domains[%d].compare_with", i), domain.CompareWith)
+	}
 }
 
 // SendTelegramNotify sends notify if IP is changed
@@ -259,13 +275,16 @@ func SendTelegramNotify(configuration *Settings, domain, currentIP string) error
 		return errors.New("chat id cannot be empty")
 	}
 
-	client := GetHttpClient(configuration, configuration.Notify.Telegram.UseProxy)
 	tpl := configuration.Notify.Telegram.MsgTemplate
 	if tpl == "" {
 		tpl = "_Your IP address is changed to_%0A%0A*{{ .CurrentIP }}*%0A%0ADomain *{{ .Domain }}* is updated"
 	}
 
-	msg := buildTemplate(currentIP, domain, tpl)
+	return sendTelegramMessage(configuration, buildTemplate(currentIP, domain, tpl))
+}
+
+func sendTelegramMessage(configuration *Settings, msg string) error {
+	client := GetHttpClient(configuration, configuration.Notify.Telegram.UseProxy)
 	reqURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage?chat_id=%s&parse_mode=Markdown&text=%s",
 		configuration.Notify.Telegram.BotApiKey,
 		configuration.Notify.Telegram.ChatId,
@@ -276,7 +295,8 @@ func SendTelegramNotify(configuration *Settings, domain, currentIP string) error
 	response, err = client.Get(reqURL)
 
 	if err != nil {
-		return err
+		// the URL of the error holds the bot key
+		return RedactError(err)
 	}
 
 	defer response.Body.Close()
@@ -296,7 +316,7 @@ func SendTelegramNotify(configuration *Settings, domain, currentIP string) error
 	var resp APIResponse
 	err = json.Unmarshal(body, &resp)
 	if err != nil {
-		fmt.Println("error:", err)
+		Error("Failed to parse the response:", err)
 		return errors.New("failed to parse response")
 	}
 	if !resp.Ok {
@@ -311,15 +331,19 @@ func SendMailNotify(configuration *Settings, domain, currentIP string) error {
 	if !configuration.Notify.Mail.Enabled {
 		return nil
 	}
-	log.Print("Sending notification to:", configuration.Notify.Mail.SendTo)
+	Debug("currentIP:", currentIP)
+	Debug("domain:", domain)
+	return sendMailMessage(configuration, "GoDNS Notification", buildTemplate(currentIP, domain, mailTemplate))
+}
+
+func sendMailMessage(configuration *Settings, subject, body string) error {
+	Info("Sending notification to:", configuration.Notify.Mail.SendTo)
 	m := gomail.NewMessage()
 
 	m.SetHeader("From", configuration.Notify.Mail.SMTPUsername)
 	m.SetHeader("To", configuration.Notify.Mail.SendTo)
-	m.SetHeader("Subject", "GoDNS Notification")
-	log.Println("currentIP:", currentIP)
-	log.Println("domain:", domain)
-	m.SetBody("text/html", buildTemplate(currentIP, domain, mailTemplate))
+	m.SetHeader("Subject", subject)
+	m.SetBody("text/html", body)
 
 	d := gomail.NewDialer(configuration.Notify.Mail.SMTPServer, configuration.Notify.Mail.SMTPPort, configuration.Notify.Mail.SMTPUsername, configuration.Notify.Mail.SMTPPassword)
 
@@ -335,7 +359,7 @@ func SaveToInfluxDB(configuration *Settings, domain, currentIP string) error {
 	if !configuration.Notify.Influx.Enabled {
 		return nil
 	}
-	log.Print("Sending notification to:", configuration.Notify.Influx.SendTo)
+	Info("Sending notification to:", configuration.Notify.Influx.SendTo)
 	influxPort := strconv.Itoa(configuration.Notify.Influx.INFLUXPort)
 
 	sURL := configuration.Notify.Influx.INFLUXServer + ":" + influxPort
@@ -379,13 +403,16 @@ func SendSlackNotify(configuration *Settings, domain, currentIP string) error {
 	if configuration.Notify.Slack.Channel == "" {
 		return errors.New("channel cannot be empty")
 	}
-	client := GetHttpClient(configuration, configuration.Notify.Slack.UseProxy)
 	tpl := configuration.Notify.Slack.MsgTemplate
 	if tpl == "" {
 		tpl = "_Your IP address is changed to_\n\n*{{ .CurrentIP }}*\n\nDomain *{{ .Domain }}* is updated"
 	}
 
-	msg := buildTemplate(currentIP, domain, tpl)
+	return sendSlackMessage(configuration, buildTemplate(currentIP, domain, tpl))
+}
+
+func sendSlackMessage(configuration *Settings, msg string) error {
+	client := GetHttpClient(configuration, configuration.Notify.Slack.UseProxy)
 
 	var response *http.Response
 	var err error
@@ -419,7 +446,7 @@ func SendSlackNotify(configuration *Settings, domain, currentIP string) error {
 	var resp APIResponse
 	err = json.Unmarshal(body, &resp)
 	if err != nil {
-		fmt.Println("error:", err)
+		Error("Failed to parse the response:", err)
 		return errors.New("failed to parse response")
 	}
 	if !resp.Ok {
@@ -433,49 +460,172 @@ func SendSlackNotify(configuration *Settings, domain, currentIP string) error {
 func SendNotify(configuration *Settings, domain, currentIP string) error {
 	err := SendTelegramNotify(configuration, domain, currentIP)
 	if err != nil {
-		log.Println("Send telegram notification with error:", err.Error())
+		Error("Send telegram notification with error:", err.Error())
 	}
 	err = SendMailNotify(configuration, domain, currentIP)
 	if err != nil {
-		log.Println("Send email notification with error:", err.Error())
+		Error("Send email notification with error:", err.Error())
 	}
 	err = SendSlackNotify(configuration, domain, currentIP)
 	if err != nil {
-		log.Println("Send slack notification with error:", err.Error())
+		Error("Send slack notification with error:", err.Error())
 	}
 	err = SaveToInfluxDB(configuration, domain, currentIP)
 	if err != nil {
-		log.Println("Send email notification with error:", err.Error())
+		Error("Send email notification with error:", err.Error())
 	}
 	return nil
 }
 
-func buildTemplate(currentIP, domain string, tplsrc string) string {
-	t := template.New("notification template")
-	if _, err := t.Parse(tplsrc); err != nil {
-		log.Println("Failed to parse template")
-		return ""
+// SendVerifyNotify sends the outcome of a post-update verification
+func SendVerifyNotify(configuration *Settings, domain, currentIP string, result VerifyResult) error {
+	data := struct {
+		CurrentIP string
+		Domain    string
+		Result    VerifyResult
+	}{
+		currentIP,
+		domain,
+		result,
 	}
 
+	if configuration.Notify.Telegram.Enabled {
+		msg := renderTemplate("Verification of *{{ .Domain }}* ({{ .CurrentIP }}): *{{ .Result }}*", data)
+		if err := sendTelegramMessage(configuration, msg); err != nil {
+			Error("Send telegram notification with error:", err.Error())
+		}
+	}
+
+	if configuration.Notify.Mail.Enabled {
+		msg := renderTemplate("<p>Verification of <strong>{{ .Domain }}</strong> ({{ .CurrentIP }}): <strong>{{ .Result }}</strong></p>", data)
+		if err := sendMailMessage(configuration, "GoDNS Verification", msg); err != nil {
+			Error("Send email notification with error:", err.Error())
+		}
+	}
+
+	if configuration.Notify.Slack.Enabled {
+		msg := renderTemplate("Verification of *{{ .Domain }}* ({{ .CurrentIP }}): *{{ .Result }}*", data)
+		if err := sendSlackMessage(configuration, msg); err != nil {
+			Error("Send slack notification with error:", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// SendFailoverNotify sends a switch of domain from the uplink from to the
+// uplink to, a recovery when to is preferred
+func SendFailoverNotify(configuration *Settings, domain, currentIP, from, to string, recovery bool) error {
+	event := "Failover"
+	if recovery {
+		event = "Recovery"
+	}
 	data := struct {
 		CurrentIP string
 		Domain    string
+		Event     string
+		From      string
+		To        string
 	}{
 		currentIP,
 		domain,
+		event,
+		from,
+		to,
+	}
+
+	if configuration.Notify.Telegram.Enabled {
+		msg := renderTemplate("{{ .Event }} of *{{ .Domain }}* from {{ .From }} to *{{ .To }}* ({{ .CurrentIP }})", data)
+		if err := sendTelegramMessage(configuration, msg); err != nil {
+			Error("Send telegram notification with error:", err.Error())
+		}
+	}
+
+	if configuration.Notify.Mail.Enabled {
+		msg := renderTemplate("<p>{{ .Event }} of <strong>{{ .Domain }}</strong> from {{ .From }} to <strong>{{ .To }}</strong> ({{ .CurrentIP }})</p>", data)
+		if err := sendMailMessage(configuration, "GoDNS "+event, msg); err != nil {
+			Error("Send email notification with error:", err.Error())
+		}
+	}
+
+	if configuration.Notify.Slack.Enabled {
+		msg := renderTemplate("{{ .Event }} of *{{ .Domain }}* from {{ .From }} to *{{ .To }}* ({{ .CurrentIP }})", data)
+		if err := sendSlackMessage(configuration, msg); err != nil {
+			Error("Send slack notification with error:", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// NotifyCheck is the outcome of a test message sent through a notifier
+type NotifyCheck struct {
+	Notifier string
+	Err      error
+}
+
+// SendTestNotify sends a test message through each enabled notifier
+func SendTestNotify(configuration *Settings) []NotifyCheck {
+	var checks []NotifyCheck
+	msg := "GoDNS test message, the notification settings are working"
+
+	if configuration.Notify.Telegram.Enabled {
+		checks = append(checks, NotifyCheck{"telegram", sendTelegramMessage(configuration, msg)})
+	}
+	if configuration.Notify.Mail.Enabled {
+		checks = append(checks, NotifyCheck{"mail", sendMailMessage(configuration, "GoDNS Test", "<p>"+msg+"</p>")})
+	}
+	if configuration.Notify.Slack.Enabled {
+		checks = append(checks, NotifyCheck{"slack", sendSlackMessage(configuration, msg)})
+	}
+
+	return checks
+}
+
+func buildTemplate(currentIP, domain string, tplsrc string) string {
+	data := struct {
+		CurrentIP string
+		Domain    string
+	}{
+		currentIP,
+		domain,
+	}
+
+	return renderTemplate(tplsrc, data)
+}
+
+func renderTemplate(tplsrc string, data interface{}) string {
+	t := template.New("notification template")
+	if _, err := t.Parse(tplsrc); err != nil {
+		Error("Failed to parse template")
+		return ""
 	}
 
 	var tpl bytes.Buffer
 	if err := t.Execute(&tpl, data); err != nil {
-		log.Println(err.Error())
+		Error(err.Error())
 		return ""
 	}
 
-	return tpl.String()
+	// the notifications should not carry any secret
+	return Redact(tpl.String())
 }
 
+// lookupHost resolves with the default resolver
+var lookupHost = net.LookupHost
+
 // ResolveDNS will query DNS for a given hostname.
 func ResolveDNS(hostname, resolver, ipType string) (string, error) {
+	ips, err := ResolveDNSAll(hostname, resolver, ipType)
+	if err != nil {
+		return "<nil>", err
+	}
+	return ips[0], nil
+}
+
+// ResolveDNSAll queries DNS for every address of hostname, such as the
+// members of a round-robin record
+func ResolveDNSAll(hostname, resolver, ipType string) ([]string, error) {
 	var dnsType uint16
 	if ipType == "" || strings.ToUpper(ipType) == IPV4 {
 		dnsType = dns.TypeA
@@ -483,24 +633,36 @@ func ResolveDNS(hostname, resolver, ipType string) (string, error) {
 		dnsType = dns.TypeAAAA
 	}
 
-	// If no DNS server is set in config file, falls back to default resolver.
+	// If no DNS server is set in config file, falls back to default resolver,
+	// which returns the addresses of both families.
 	if resolver == "" {
-		dnsAdress, err := net.LookupHost(hostname)
+		all, err := lookupHost(hostname)
 		if err != nil {
-			return "<nil>", err
+			return nil, err
 		}
-
-		return dnsAdress[0], nil
+		var addrs []string
+		for _, addr := range all {
+			if ip := net.ParseIP(addr); ip != nil && (ip.To4() != nil) == (dnsType == dns.TypeA) {
+				addrs = append(addrs, addr)
+			}
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no %s address found for %s", dns.TypeToString[dnsType], hostname)
+		}
+		return addrs, nil
 	}
 	res := dnsResolver.New([]string{resolver})
 	// In case of i/o timeout
 	res.RetryTimes = 5
 
-	ip, err := res.LookupHost(hostname, dnsType)
+	ips, err := res.LookupHost(hostname, dnsType)
 	if err != nil {
-		return "<nil>", err
+		return nil, err
 	}
 
-	return ip[0].String(), nil
-
+	var addrs []string
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	return addrs, nil
 }
@@ -0,0 +1,463 @@
+package godns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigError is a problem of the setting at Path, such as
+// domains[0].sub_domains
+type ConfigError struct {
+	Path    string
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ConfigErrors lists every problem found in the settings
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *ConfigErrors) add(path, format string, args ...interface{}) {
+	*e = append(*e, ConfigError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns nil when no problem was found, so that the result can be
+// compared against nil
+func (e ConfigErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// checkDocument reports the fields of the config document which do not
+// exist in Settings, and the values which do not have the type of their
+// field. Unlike json.Unmarshal it goes on after the first problem.
+func checkDocument(config map[string]interface{}) error {
+	// the formats decode numbers and lists to different types, JSON
+	// gives one representation for all of them
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return err
+	}
+
+	var errs ConfigErrors
+	if object, ok := doc.(map[string]interface{}); ok {
+		// editors find the schema of the file with it
+		delete(object, "$schema")
+	}
+	checkValue(doc, reflect.TypeOf(Settings{}), "", &errs)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return errs.err()
+}
+
+func checkValue(value interface{}, t reflect.Type, path string, errs *ConfigErrors) {
+	if value == nil || t == rawMessageType {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			errs.add(path, "must be a string")
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			errs.add(path, "must be true or false")
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			errs.add(path, "must be an integer")
+		}
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok {
+			errs.add(path, "must be a list")
+			return
+		}
+		for i, item := range list {
+			checkValue(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			errs.add(path, "must be an object")
+			return
+		}
+		for key, item := range object {
+			checkValue(item, t.Elem(), joinPath(path, key), errs)
+		}
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			errs.add(path, "must be an object")
+			return
+		}
+		fields := jsonFields(t)
+		for key, item := range object {
+			field, ok := fields[key]
+			if !ok {
+				if suggestion := closestField(key, fields); suggestion != "" {
+					errs.add(joinPath(path, key), "unknown field, did you mean %s?", suggestion)
+				} else {
+					errs.add(joinPath(path, key), "unknown field")
+				}
+				continue
+			}
+			checkValue(item, field.Type, joinPath(path, key), errs)
+		}
+	}
+}
+
+// jsonFields returns the fields of struct t by their json name
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := jsonName(field)
+		if key != "" {
+			fields[key] = field
+		}
+	}
+	return fields
+}
+
+// jsonName returns the name of field in the config file, empty when the
+// field is not part of it
+func jsonName(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("json"), ",")[0]
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// closestField suggests the field a misspelt key was meant to be
+func closestField(key string, fields map[string]reflect.StructField) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		if d := editDistance(key, name); d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// checkDomains reports the domains which cannot be updated
+func checkDomains(config *Settings, errs *ConfigErrors) {
+	for i, domain := range config.Domains {
+		path := fmt.Sprintf("domains[%d]", i)
+		if domain.DomainName == "" {
+			errs.add(path+".domain_name", "cannot be empty")
+		}
+		// the dyndns2 server updates the hostnames its clients send, which
+		// are not listed here
+		if len(domain.SubDomains) == 0 && !config.DynDNS2Server.Enabled {
+			errs.add(path+".sub_domains", "cannot be empty")
+		}
+		for j, subDomain := range domain.SubDomains {
+			if subDomain == "" {
+				errs.add(fmt.Sprintf("%s.sub_domains[%d]", path, j), "cannot be empty")
+			}
+		}
+		for j, member := range domain.Membership {
+			found := false
+			for _, subDomain := range domain.SubDomains {
+				found = found || subDomain == member
+			}
+			if !found {
+				errs.add(fmt.Sprintf("%s.membership[%d]", path, j), "%s is not in sub_domains", member)
+			}
+		}
+		// the previous address of this host, to remove, is only known
+		// after a restart from the state file
+		if len(domain.Membership) > 0 && config.StatePath == "" {
+			errs.add(path+".membership", "needs state_path, to remove the previous address of this host after a restart")
+		}
+	}
+}
+
+// checkIP reports the settings used to find the current IP
+func checkIP(config *Settings, errs *ConfigErrors) {
+	switch strings.ToUpper(config.IPType) {
+	case "", IPV4, IPV6:
+	default:
+		errs.add("ip_type", "must be IPv4 or IPv6, got %q", config.IPType)
+	}
+	if config.Interval < 0 {
+		errs.add("interval", "cannot be negative")
+	}
+}
+
+// checkIPSources reports the ip_sources entries which cannot give an IP,
+// and the references to missing ones
+func checkIPSources(config *Settings, errs *ConfigErrors) {
+	var names []string
+	for name := range config.IPSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		source := config.IPSources[name]
+		path := "ip_sources." + name
+		if source.IPInterface == "" && source.IPUrl == "" && source.IPV6Url == "" && config.IPUrl == "" && config.IPV6Url == "" {
+			errs.add(path, "needs ip_interface, ip_url or ipv6_url")
+		}
+		if source.SourceIP != "" && net.ParseIP(source.SourceIP) == nil {
+			errs.add(path+".source_ip", "must be an IP address, got %q", source.SourceIP)
+		}
+		if source.SourceIP != "" && source.SourceInterface != "" {
+			errs.add(path+".source_interface", "cannot be set with source_ip")
+		}
+		checkHealthCheck(source.HealthCheck, path+".health_check", errs)
+	}
+
+	for i, domain := range config.Domains {
+		path := fmt.Sprintf("domains[%d]", i)
+		if _, ok := config.IPSources[domain.IPSource]; domain.IPSource != "" && !ok {
+			errs.add(path+".ip_source", "no ip_sources entry named %q", domain.IPSource)
+		}
+
+		for j, name := range domain.Failover.IPSources {
+			if _, ok := config.IPSources[name]; !ok {
+				errs.add(fmt.Sprintf("%s.failover.ip_sources[%d]", path, j), "no ip_sources entry named %q", name)
+			}
+		}
+		if domain.Failover.HoldDown < 0 {
+			errs.add(path+".failover.hold_down", "cannot be negative")
+		}
+		if len(domain.Failover.IPSources) > 0 && (domain.IPSource != "" || len(domain.SubDomainIPSources) > 0) {
+			errs.add(path+".failover", "cannot be set with ip_source or sub_domain_ip_sources")
+		}
+
+		var subDomains []string
+		for subDomain := range domain.SubDomainIPSources {
+			subDomains = append(subDomains, subDomain)
+		}
+		sort.Strings(subDomains)
+		for _, subDomain := range subDomains {
+			name := domain.SubDomainIPSources[subDomain]
+			subPath := path + ".sub_domain_ip_sources." + subDomain
+			if _, ok := config.IPSources[name]; name != "" && !ok {
+				errs.add(subPath, "no ip_sources entry named %q", name)
+			}
+			found := false
+			for _, listed := range domain.SubDomains {
+				found = found || listed == subDomain
+			}
+			if !found {
+				errs.add(subPath, "%s is not in sub_domains", subDomain)
+			}
+		}
+	}
+}
+
+// checkHealthCheck reports the health checks which cannot be run
+func checkHealthCheck(check HealthCheck, path string, errs *ConfigErrors) {
+	if check.Timeout < 0 {
+		errs.add(path+".timeout", "cannot be negative")
+	}
+	switch strings.ToLower(check.Type) {
+	case "":
+		return
+	case HealthICMP:
+	case HealthTCP:
+		if _, _, err := net.SplitHostPort(check.Target); err != nil {
+			errs.add(path+".target", "must be a host:port, got %q", check.Target)
+			return
+		}
+	case HealthHTTP:
+		if u, err := url.Parse(check.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs.add(path+".target", "must be an http or https URL, got %q", check.Target)
+			return
+		}
+	default:
+		errs.add(path+".type", "must be icmp, tcp or http, got %q", check.Type)
+		return
+	}
+	if check.Target == "" {
+		errs.add(path+".target", "cannot be empty")
+	}
+}
+
+// checkLog reports the log_ settings SetupLogger would reject
+func checkLog(config *Settings, errs *ConfigErrors) {
+	if _, err := ParseLevel(config.LogLevel); err != nil {
+		errs.add("log_level", "must be debug, info, warn or error, got %q", config.LogLevel)
+	}
+	switch strings.ToLower(config.LogFormat) {
+	case "", LogText, LogJSON:
+	default:
+		errs.add("log_format", "must be text or json, got %q", config.LogFormat)
+	}
+	if config.LogMaxSize < 0 {
+		errs.add("log_max_size", "cannot be negative")
+	}
+	if config.LogMaxAge < 0 {
+		errs.add("log_max_age", "cannot be negative")
+	}
+	if config.LogBackups < 0 {
+		errs.add("log_max_backups", "cannot be negative")
+	}
+	switch {
+	case config.LogSyslog == "", config.LogSyslog == "syslog", config.LogSyslog == "journald":
+	case strings.HasPrefix(config.LogSyslog, "udp://"), strings.HasPrefix(config.LogSyslog, "tcp://"):
+	default:
+		errs.add("log_syslog", "must be syslog, journald, udp://host:port or tcp://host:port, got %q", config.LogSyslog)
+	}
+}
+
+// checkHTTP reports the http settings the HTTP client could not be
+// created from
+func checkHTTP(config *Settings, errs *ConfigErrors) {
+	conf := config.HTTP
+	if conf.Timeout < 0 {
+		errs.add("http.timeout", "cannot be negative")
+	}
+	if conf.ConnectTimeout < 0 {
+		errs.add("http.connect_timeout", "cannot be negative")
+	}
+	if conf.Proxy != "" {
+		u, err := url.Parse(conf.Proxy)
+		if err != nil {
+			errs.add("http.proxy", "invalid URL: %s", RedactError(err))
+		} else {
+			switch u.Scheme {
+			case "http", "https", "socks5", "socks5h":
+			default:
+				errs.add("http.proxy", "must be an http, https or socks5 URL, got scheme %q", u.Scheme)
+			}
+		}
+	}
+	if conf.TLSMinVersion != "" {
+		if _, ok := tlsVersions[conf.TLSMinVersion]; !ok {
+			errs.add("http.tls_min_version", "must be 1.0, 1.1, 1.2 or 1.3, got %q", conf.TLSMinVersion)
+		}
+	}
+	if conf.CABundle != "" {
+		if _, err := os.Stat(conf.CABundle); err != nil {
+			errs.add("http.ca_bundle", "%s", err)
+		}
+	}
+	if conf.SourceIP != "" && net.ParseIP(conf.SourceIP) == nil {
+		errs.add("http.source_ip", "must be an IP address, got %q", conf.SourceIP)
+	}
+	if conf.SourceIP != "" && conf.SourceInterface != "" {
+		errs.add("http.source_interface", "cannot be set with http.source_ip")
+	}
+}
+
+// checkOwnership reports the owner_id which could not be found back in
+// the markers
+func checkOwnership(config *Settings, errs *ConfigErrors) {
+	if !ownerIDPattern.MatchString(config.Ownership.OwnerID) {
+		errs.add("ownership.owner_id", "can only have letters, digits, dots, dashes and underscores, got %q", config.Ownership.OwnerID)
+	}
+}
+
+// checkNotify reports the enabled notifiers which miss their settings
+func checkNotify(config *Settings, errs *ConfigErrors) {
+	notify := config.Notify
+	if notify.Telegram.Enabled {
+		if notify.Telegram.BotApiKey == "" {
+			errs.add("notify.telegram.bot_api_key", "cannot be empty")
+		}
+		if notify.Telegram.ChatId == "" {
+			errs.add("notify.telegram.chat_id", "cannot be empty")
+		}
+	}
+	if notify.Slack.Enabled {
+		if notify.Slack.BotApiToken == "" {
+			errs.add("notify.slack.bot_api_token", "cannot be empty")
+		}
+		if notify.Slack.Channel == "" {
+			errs.add("notify.slack.channel", "cannot be empty")
+		}
+	}
+	if notify.Mail.Enabled {
+		if notify.Mail.SMTPServer == "" {
+			errs.add("notify.mail.smtp_server", "cannot be empty")
+		}
+		if notify.Mail.SMTPPort <= 0 {
+			errs.add("notify.mail.smtp_port", "must be a port number")
+		}
+		if notify.Mail.SendTo == "" {
+			errs.add("notify.mail.send_to", "cannot be empty")
+		}
+	}
+	if notify.Influx.Enabled {
+		if notify.Influx.INFLUXServer == "" {
+			errs.add("notify.influx.influx_server", "cannot be empty")
+		}
+		if notify.Influx.INFLUXPort <= 0 {
+			errs.add("notify.influx.influx_port", "must be a port number")
+		}
+		if notify.Influx.SendTo == "" {
+			errs.add("notify.influx.send_to", "cannot be empty")
+		}
+	}
+}
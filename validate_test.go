@@ -0,0 +1,94 @@
+package godns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckDocument(t *testing.T) {
+	config := map[string]interface{}{
+		"$schema":  SchemaURL,
+		"provider": "Cloudflare",
+		"ip_typ":   "IPv6",
+		"interval": "300",
+		"domains": []interface{}{
+			map[string]interface{}{"domain_name": "example.com", "sub_domain": []interface{}{"www"}},
+		},
+		"plugin": map[string]interface{}{"config": map[string]interface{}{"anything": true}},
+	}
+
+	err := checkDocument(config)
+	errs, ok := err.(ConfigErrors)
+	if !ok {
+		t.Fatalf("should return ConfigErrors, got %v", err)
+	}
+
+	expected := []string{
+		"domains[0].sub_domain: unknown field, did you mean sub_domains?",
+		"interval: must be an integer",
+		"ip_typ: unknown field, did you mean ip_type?",
+	}
+	if errs.Error() != strings.Join(expected, "\n") {
+		t.Errorf("expected every problem with its path, got:\n%s", errs)
+	}
+}
+
+func TestCheckSettingsPaths(t *testing.T) {
+	config := &Settings{
+		Provider:  HE,
+		IPType:    "IPv5",
+		Domains:   []Domain{{DomainName: "example.com", IPSource: "wan3", Membership: []string{"api"}, Failover: FailoverSettings{IPSources: []string{"wan1", "wan4"}}}, {SubDomains: []string{"www"}, CompareWith: []string{"dns", "cache"}, SubDomainIPSources: map[string]string{"vpn": "wan1"}}},
+		IPSources: map[string]IPSource{"wan1": {IPInterface: "eth0", SourceIP: "eth0", HealthCheck: HealthCheck{Type: HealthTCP, Target: "198.51.100.1"}}},
+		Notify:    Notify{Telegram: TelegramNotify{Enabled: true, BotApiKey: "key"}},
+		Ownership: OwnershipSettings{Enabled: true, OwnerID: "office router"},
+		HTTP:      HTTPSettings{Timeout: -1, Proxy: "ftp://proxy", TLSMinVersion: "1.4", SourceIP: "192.0.2.300", SourceInterface: "eth0"},
+	}
+
+	err := CheckSettings(config)
+	if err == nil {
+		t.Fatal("settings are invalid, should return errors")
+	}
+
+	for _, path := range []string{"ip_type", "domains[0].sub_domains", "domains[1].domain_name", "domains[1].compare_with[1]", "notify.telegram.chat_id", "http.timeout", "http.proxy", "http.tls_min_version", "http.source_ip", "http.source_interface", "domains[0].ip_source", "domains[1].sub_domain_ip_sources.vpn", "ip_sources.wan1.source_ip", "ip_sources.wan1.health_check.target", "domains[0].failover.ip_sources[1]", "domains[0].failover", "domains[0].membership", "domains[0].membership[0]", "ownership.enabled", "ownership.owner_id"} {
+		if !strings.Contains(err.Error(), path+": ") {
+			t.Errorf("should report %s, got:\n%s", path, err)
+		}
+	}
+}
+
+func TestCheckMembershipStatePath(t *testing.T) {
+	config := &Settings{
+		Provider: CLOUDFLARE,
+		Domains:  []Domain{{DomainName: "example.com", SubDomains: []string{"api"}, Membership: []string{"api"}}},
+	}
+
+	var errs ConfigErrors
+	checkDomains(config, &errs)
+	if !strings.Contains(errs.Error(), "domains[0].membership: needs state_path") {
+		t.Errorf("membership should need state_path, got:\n%s", errs)
+	}
+
+	config.StatePath = "state.json"
+	errs = nil
+	checkDomains(config, &errs)
+	if errs.err() != nil {
+		t.Errorf("membership with state_path should be valid, got:\n%s", errs)
+	}
+}
+
+func TestCheckDomainsDynDNS2Server(t *testing.T) {
+	config := &Settings{Domains: []Domain{{DomainName: "example.com"}}}
+
+	var errs ConfigErrors
+	checkDomains(config, &errs)
+	if !strings.Contains(errs.Error(), "domains[0].sub_domains: cannot be empty") {
+		t.Errorf("sub_domains should not be empty, got:\n%s", errs)
+	}
+
+	config.DynDNS2Server.Enabled = true
+	errs = nil
+	checkDomains(config, &errs)
+	if errs.err() != nil {
+		t.Errorf("sub_domains may be empty with the dyndns2 server, got:\n%s", errs)
+	}
+}
@@ -0,0 +1,157 @@
+package godns
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	dnsResolver "github.com/jmbayu/godns/resolver"
+
+	"github.com/miekg/dns"
+)
+
+// VerifyResult is the outcome of a post-update verification
+type VerifyResult string
+
+const (
+	// Verified means the provider and every resolver returned the new value
+	Verified VerifyResult = "verified"
+	// VerifyTimedOut means the new value did not show up before the deadline
+	VerifyTimedOut VerifyResult = "timed-out"
+	// VerifyMismatched means the provider stored a different value than the one sent
+	VerifyMismatched VerifyResult = "mismatched"
+)
+
+// ReadBackFunc reads the current value of a record back through the provider API
+type ReadBackFunc func() (string, error)
+
+// RecordUpdated is called by handlers once a record has been updated.
+// It saves the new value to the state store and, if enabled, verifies
+// the update in the background.
+func RecordUpdated(configuration *Settings, hostname, ip string, readBack ReadBackFunc) {
+	GetStateStore(configuration).SetIP(hostname, ip)
+
+	if !configuration.Verify.Enabled {
+		return
+	}
+
+	go func() {
+		result := Verify(configuration, hostname, ip, readBack)
+		Infof("Verification of %s (%s): %s", hostname, ip, result)
+		GetStateStore(configuration).SetVerification(hostname, result)
+
+		if configuration.Verify.Notify {
+			if err := SendVerifyNotify(configuration, hostname, ip, result); err != nil {
+				Error("Failed to send verification notification")
+			}
+		}
+	}()
+}
+
+// Verify checks that an update of hostname to ip has taken effect.
+// The record is first read back through the provider when readBack is given,
+// then the authoritative name servers and the configured resolver are polled
+// until they all return ip or the verification timeout expires.
+func Verify(configuration *Settings, hostname, ip string, readBack ReadBackFunc) VerifyResult {
+	deadline := time.Now().Add(time.Second * time.Duration(configuration.Verify.Timeout))
+	interval := time.Second * time.Duration(configuration.Verify.Interval)
+
+	if readBack != nil {
+		for {
+			value, err := readBack()
+			if err == nil {
+				if value != ip {
+					Warnf("Provider returned %s for %s, expected %s", value, hostname, ip)
+					return VerifyMismatched
+				}
+				break
+			}
+
+			Error("Failed to read back record:", err)
+			if time.Now().Add(interval).After(deadline) {
+				return VerifyTimedOut
+			}
+			time.Sleep(interval)
+		}
+	}
+
+	servers, err := AuthoritativeServers(hostname, configuration.Resolver)
+	if err != nil {
+		Error("Failed to find authoritative name servers:", err)
+	}
+
+	pending := map[string]bool{configuration.Resolver: true}
+	for _, server := range servers {
+		pending[server] = true
+	}
+
+	for {
+		for server := range pending {
+			value, err := ResolveDNS(hostname, server, configuration.IPType)
+			if err == nil && value == ip {
+				delete(pending, server)
+			}
+		}
+
+		if len(pending) == 0 {
+			return Verified
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			for server := range pending {
+				Warnf("%s is not yet updated on %s", hostname, serverName(server))
+			}
+			return VerifyTimedOut
+		}
+		time.Sleep(interval)
+	}
+}
+
+// nameServerPort is the port the name servers are queried on
+var nameServerPort = "53"
+
+// resolvConf lists the default resolvers
+var resolvConf = "/etc/resolv.conf"
+
+// AuthoritativeServers returns the addresses of the name servers of the zone
+// enclosing hostname, looked up through resolver, as host:port
+func AuthoritativeServers(hostname, resolver string) ([]string, error) {
+	var res *dnsResolver.DNSResolver
+	if resolver != "" {
+		res = dnsResolver.New([]string{resolver})
+	} else {
+		var err error
+		if res, err = dnsResolver.NewFromResolvConf(resolvConf); err != nil {
+			return nil, err
+		}
+	}
+
+	names, err := res.LookupNS(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []string
+	for _, name := range names {
+		addrs, err := net.LookupHost(strings.TrimSuffix(name, "."))
+		if err != nil || len(addrs) == 0 {
+			Warn("Cannot resolve name server", name)
+			continue
+		}
+		servers = append(servers, net.JoinHostPort(addrs[0], nameServerPort))
+	}
+
+	if len(servers) == 0 {
+		return nil, errors.New("cannot resolve any name server of " + dns.Fqdn(hostname))
+	}
+
+	return servers, nil
+}
+
+func serverName(server string) string {
+	if server == "" {
+		return "the system resolver"
+	}
+	return server
+}
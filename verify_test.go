@@ -0,0 +1,128 @@
+package godns
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// zoneServer serves example.com, with itself as its name server and the
+// A record of www
+type zoneServer struct {
+	sync.Mutex
+	server *dns.Server
+	ip     string
+}
+
+func startZoneServer(t *testing.T, ip string) *zoneServer {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zs := &zoneServer{ip: ip}
+	started := make(chan struct{})
+	zs.server = &dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+		Handler:           dns.HandlerFunc(zs.serveDNS),
+	}
+
+	go zs.server.ActivateAndServe()
+	<-started
+
+	return zs
+}
+
+func (zs *zoneServer) addr() string {
+	return zs.server.PacketConn.LocalAddr().String()
+}
+
+func (zs *zoneServer) setIP(ip string) {
+	zs.Lock()
+	defer zs.Unlock()
+	zs.ip = ip
+}
+
+func (zs *zoneServer) serveDNS(w dns.ResponseWriter, r *dns.Msg) {
+	zs.Lock()
+	defer zs.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	q := r.Question[0]
+	switch {
+	case q.Qtype == dns.TypeNS && q.Name == "example.com.":
+		rr, _ := dns.NewRR("example.com. 300 IN NS 127.0.0.1.")
+		m.Answer = append(m.Answer, rr)
+	case q.Qtype == dns.TypeA && q.Name == "www.example.com.":
+		rr, _ := dns.NewRR("www.example.com. 300 IN A " + zs.ip)
+		m.Answer = append(m.Answer, rr)
+	}
+
+	w.WriteMsg(m)
+}
+
+func TestVerify(t *testing.T) {
+	zs := startZoneServer(t, "192.0.2.1")
+	defer zs.server.Shutdown()
+
+	_, port, _ := net.SplitHostPort(zs.addr())
+	defer func(port string) { nameServerPort = port }(nameServerPort)
+	nameServerPort = port
+
+	servers, err := AuthoritativeServers("www.example.com", zs.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0] != zs.addr() {
+		t.Fatalf("the name server should be %s, got %v", zs.addr(), servers)
+	}
+
+	configuration := &Settings{
+		Resolver: zs.addr(),
+		IPType:   IPV4,
+		Verify:   VerifySettings{Enabled: true, Timeout: 1, Interval: 1},
+	}
+	readBack := func(value string) ReadBackFunc {
+		return func() (string, error) { return value, nil }
+	}
+
+	if result := Verify(configuration, "www.example.com", "192.0.2.1", readBack("192.0.2.1")); result != Verified {
+		t.Errorf("the update should be verified, got %s", result)
+	}
+	if result := Verify(configuration, "www.example.com", "192.0.2.1", readBack("192.0.2.9")); result != VerifyMismatched {
+		t.Errorf("a different value at the provider should be mismatched, got %s", result)
+	}
+
+	zs.setIP("198.51.100.7")
+	if result := Verify(configuration, "www.example.com", "192.0.2.1", nil); result != VerifyTimedOut {
+		t.Errorf("a stale name server should time out, got %s", result)
+	}
+}
+
+func TestVerifyDefaultResolver(t *testing.T) {
+	// no name server is found, only the default resolver is queried
+	defer func(path string) { resolvConf = path }(resolvConf)
+	resolvConf = "/file/does/not/exist"
+	defer func(lookup func(string) ([]string, error)) { lookupHost = lookup }(lookupHost)
+	lookupHost = func(string) ([]string, error) {
+		return []string{"192.0.2.1", "2001:db8::1"}, nil
+	}
+
+	configuration := &Settings{
+		IPType: IPV6,
+		Verify: VerifySettings{Enabled: true, Timeout: 1, Interval: 1},
+	}
+	if result := Verify(configuration, "www.example.com", "2001:db8::1", nil); result != Verified {
+		t.Errorf("the IPv6 address should be verified, got %s", result)
+	}
+
+	configuration.IPType = IPV4
+	if result := Verify(configuration, "www.example.com", "192.0.2.1", nil); result != Verified {
+		t.Errorf("the IPv4 address should be verified, got %s", result)
+	}
+}